@@ -0,0 +1,191 @@
+package main
+
+import (
+	"ImageZipResize/tool/imagetool"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/system"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+var backupFlags struct {
+	verify    bool
+	olderThan int
+	maxSize   string
+}
+
+var backupCommand = &command{
+	name:    "backup",
+	args:    "<files or directories...>",
+	summary: "list the backed up originals with their resized images, verify and prune them",
+	setup: func(fs *flag.FlagSet) {
+		fs.BoolVar(&backupFlags.verify, "verify", false, "decode the resized image of every backup")
+		fs.IntVar(&backupFlags.olderThan, "older-than", 0, "prune the backups older than the days")
+		fs.StringVar(&backupFlags.maxSize, "max-size", "", "prune the oldest backups until the rest fit in the size like 10GiB")
+	},
+	run: runBackup,
+}
+
+type backupStatus struct {
+	backup      imagetool.Backup
+	record      imagetool.Record
+	recorded    bool
+	resized     string
+	resizedSize int64
+	// time is when the backup was made, guessed from the resized image
+	// for backups without a record.
+	time time.Time
+	err  error
+}
+
+func (s backupStatus) age() time.Duration {
+	return time.Since(s.time)
+}
+
+func (s backupStatus) rate() float64 {
+	if s.recorded {
+		return s.record.Rate()
+	}
+	if s.backup.Size == 0 {
+		return 1
+	}
+	return float64(s.resizedSize) / float64(s.backup.Size)
+}
+
+func (s backupStatus) state() string {
+	switch {
+	case s.resized == "":
+		return "missing"
+	case s.err != nil:
+		return "broken"
+	}
+	return "ok"
+}
+
+func runBackup(opts *options, args []string) error {
+	if _, _, err := splitArgs(args); err != nil {
+		return err
+	}
+	var maxSize system.ByteSize
+	if backupFlags.maxSize != "" {
+		size, err := system.ParseByteSize(backupFlags.maxSize)
+		if err != nil {
+			return usageErrorf("invalid max size %q", backupFlags.maxSize)
+		}
+		maxSize = size
+	}
+	if backupFlags.olderThan < 0 {
+		return usageErrorf("invalid days %d", backupFlags.olderThan)
+	}
+	prune := backupFlags.olderThan > 0 || backupFlags.maxSize != ""
+
+	backups := make([]imagetool.Backup, 0)
+	for _, arg := range args {
+		found, err := opts.backups.List(arg)
+		opts.failures.Add(arg, err)
+		backups = append(backups, found...)
+	}
+	statuses := inspectBackups(opts, backups, backupFlags.verify || prune)
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].time.Before(statuses[j].time)
+	})
+
+	var total int64
+	for _, s := range statuses {
+		total += s.backup.Size
+		fmt.Printf("%-8s %6s %10s  %s -> %s\n", s.state(), formatAge(s.age()), system.ByteSize(s.backup.Size), backupName(s.backup), s.resized)
+		if s.err != nil && backupFlags.verify {
+			opts.failures.Add(s.backup.Origin, s.err)
+		}
+	}
+	fmt.Printf("%d backups, %s\n", len(statuses), system.ByteSize(total))
+	if !prune {
+		return nil
+	}
+
+	var pruned int
+	var reclaimed int64
+	kept := total
+	for _, s := range statuses {
+		tooOld := backupFlags.olderThan > 0 && s.age() > time.Duration(backupFlags.olderThan)*24*time.Hour
+		tooLarge := maxSize > 0 && kept > int64(maxSize)
+		if !tooOld && !tooLarge {
+			continue
+		}
+		if s.err != nil {
+			opts.logger.Warn("keep backup without a valid resized image", "path", backupName(s.backup), "error", s.err)
+			continue
+		}
+		if opts.dryRun {
+			fmt.Printf("would prune %s\n", backupName(s.backup))
+		} else if err := opts.backups.Remove(s.backup); err != nil {
+			opts.failures.Add(s.backup.Origin, err)
+			continue
+		} else {
+			opts.logger.Info("pruned", "path", backupName(s.backup), "size", system.ByteSize(s.backup.Size))
+		}
+		pruned++
+		reclaimed += s.backup.Size
+		kept -= s.backup.Size
+	}
+	verb := "pruned"
+	if opts.dryRun {
+		verb = "would prune"
+	}
+	fmt.Printf("%s %d backups, reclaimed %s, %s kept\n", verb, pruned, system.ByteSize(reclaimed), system.ByteSize(kept))
+	return nil
+}
+
+// inspectBackups pairs the backups with their resized images, verify decodes them.
+func inspectBackups(opts *options, backups []imagetool.Backup, verify bool) []backupStatus {
+	manifests := imagetool.NewManifests()
+	statuses := make([]backupStatus, len(backups))
+	indexes := make([]int, len(backups))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	concurrent.ForEach(indexes, func(i int) {
+		b := backups[i]
+		s := backupStatus{backup: b, time: b.ModTime}
+		s.record, s.recorded = manifests.Lookup(b)
+		if s.recorded {
+			s.resized, s.time = s.record.Resized, s.record.Time
+		} else if resized, ok := imagetool.FindResized(b.Origin); ok {
+			s.resized = resized
+		}
+		stat, err := os.Stat(s.resized)
+		switch {
+		case s.resized == "":
+			s.err = fmt.Errorf("resized image of %s, %w", b.Origin, os.ErrNotExist)
+		case err != nil:
+			s.resized, s.err = "", err
+		default:
+			s.resizedSize = stat.Size()
+			if !s.recorded {
+				s.time = stat.ModTime()
+			}
+			if verify {
+				s.err = imagetool.Verify(s.resized)
+			}
+		}
+		statuses[i] = s
+	}, opts.parallelism())
+	return statuses
+}
+
+func backupName(b imagetool.Backup) string {
+	if b.Archive != "" {
+		return b.Archive + ":" + b.Location
+	}
+	return b.Location
+}
+
+func formatAge(age time.Duration) string {
+	if age < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
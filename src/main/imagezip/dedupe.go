@@ -0,0 +1,252 @@
+package main
+
+import (
+	"ImageZipResize/tool/imagetool"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/fileutil"
+	"ImageZipResize/util/slices"
+	"ImageZipResize/util/system"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+var dedupeFlags struct {
+	distance int
+	hash     string
+	action   string
+}
+
+var dedupeCommand = &command{
+	name:    "dedupe",
+	args:    "<files or directories...>",
+	summary: "find duplicate and similar images, report, hard link or move them into .resize.dedupe",
+	setup: func(fs *flag.FlagSet) {
+		fs.IntVar(&dedupeFlags.distance, "distance", 4, "largest hamming distance of similar images, -1 for exact duplicates only")
+		fs.StringVar(&dedupeFlags.hash, "hash", "phash", "perceptual hash, phash or dhash")
+		fs.StringVar(&dedupeFlags.action, "action", "report", "report, link exact duplicates to the kept image, or move duplicates into .resize.dedupe beside the backups")
+	},
+	run: runDedupe,
+}
+
+type hashedImage struct {
+	entry
+	hashes imagetool.Hashes
+	pixels int64
+	size   int64
+}
+
+func (h hashedImage) perceptual() uint64 {
+	if dedupeFlags.hash == "dhash" {
+		return h.hashes.DHash
+	}
+	return h.hashes.PHash
+}
+
+// better tells whether h should be kept rather than other.
+func (h hashedImage) better(other hashedImage) bool {
+	if h.pixels != other.pixels {
+		return h.pixels > other.pixels
+	}
+	if h.size != other.size {
+		return h.size > other.size
+	}
+	return h.file < other.file
+}
+
+type duplicate struct {
+	hashedImage
+	exact    bool
+	distance int
+}
+
+type duplicateGroup struct {
+	keep       hashedImage
+	duplicates []duplicate
+}
+
+func runDedupe(opts *options, args []string) error {
+	files, dirs, err := splitArgs(args)
+	if err != nil {
+		return err
+	}
+	switch {
+	case dedupeFlags.hash != "phash" && dedupeFlags.hash != "dhash":
+		return usageErrorf("unknown hash %q", dedupeFlags.hash)
+	case dedupeFlags.action != "report" && dedupeFlags.action != "link" && dedupeFlags.action != "move":
+		return usageErrorf("unknown action %q", dedupeFlags.action)
+	}
+	entries, _ := collect(opts.logger, files, dirs, opts.failures)
+	entries = slices.Filter(entries, func(e entry) bool {
+		return imagetool.IsSupportedImageFilename(e.file) && !imagetool.IsOriginBackupPath(e.file) &&
+			!imagetool.IsDuplicatePath(e.file) && !fileutil.IsCachePath(e.file)
+	})
+
+	images := hashImages(opts, entries)
+	groups := groupDuplicates(images, dedupeFlags.distance)
+	var count int
+	var reclaimable int64
+	for _, g := range groups {
+		fmt.Printf("keep    %s\n", g.keep.file)
+		for _, d := range g.duplicates {
+			if d.exact {
+				fmt.Printf("  exact   %s\n", d.file)
+			} else {
+				fmt.Printf("  similar %s, distance %d\n", d.file, d.distance)
+			}
+			count++
+			reclaimable += d.size
+		}
+	}
+	fmt.Printf("%d images, %d groups, %d duplicates, %s reclaimable\n", len(images), len(groups), count, system.ByteSize(reclaimable))
+	if dedupeFlags.action == "report" {
+		return nil
+	}
+
+	for _, g := range groups {
+		for _, d := range g.duplicates {
+			if dedupeFlags.action == "link" && !d.exact {
+				continue
+			}
+			if opts.dryRun {
+				fmt.Printf("would %s %s\n", dedupeFlags.action, d.file)
+				continue
+			}
+			opts.failures.Add(d.file, resolveDuplicate(opts, g.keep, d))
+		}
+	}
+	return nil
+}
+
+func hashImages(opts *options, entries []entry) []hashedImage {
+	results := make([]*hashedImage, len(entries))
+	indexes := make([]int, len(entries))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	curr := new(atomic.Int64)
+	concurrent.ForEach(indexes, func(i int) {
+		en := entries[i]
+		tag := fmt.Sprintf("%d/%d", curr.Add(1), len(entries))
+		stat, err := os.Stat(en.file)
+		if err != nil {
+			opts.failures.Add(en.file, err)
+			return
+		}
+		info, err := imagetool.Inspect(en.file)
+		if err != nil {
+			opts.failures.Add(en.file, err)
+			return
+		}
+		hashes, err := imagetool.Hash(en.file)
+		if err != nil {
+			opts.failures.Add(en.file, err)
+			return
+		}
+		opts.logger.Debug("hashed", "path", en.file, "tag", tag, "phash", fmt.Sprintf("%016x", hashes.PHash), "dhash", fmt.Sprintf("%016x", hashes.DHash))
+		results[i] = &hashedImage{entry: en, hashes: hashes, pixels: info.Pixels(), size: stat.Size()}
+	}, opts.parallelism())
+	images := make([]hashedImage, 0, len(results))
+	for _, r := range results {
+		if r != nil {
+			images = append(images, *r)
+		}
+	}
+	return images
+}
+
+// groupDuplicates groups the images with the same content, then joins the
+// groups whose perceptual hashes are within the distance of the best image of
+// a group, which is kept. Chains of similar images do not join, every
+// duplicate is within the distance of the kept image.
+func groupDuplicates(images []hashedImage, distance int) []duplicateGroup {
+	exact := make(map[[32]byte][]int)
+	representatives := make([]int, 0)
+	for i, img := range images {
+		if len(exact[img.hashes.Sum]) == 0 {
+			representatives = append(representatives, i)
+		}
+		exact[img.hashes.Sum] = append(exact[img.hashes.Sum], i)
+	}
+	for k, r := range representatives {
+		for _, m := range exact[images[r].hashes.Sum] {
+			if images[m].better(images[representatives[k]]) {
+				representatives[k] = m
+			}
+		}
+	}
+	sort.Slice(representatives, func(i, j int) bool {
+		return images[representatives[i]].better(images[representatives[j]])
+	})
+
+	groups := make([]duplicateGroup, 0)
+	grouped := make([]bool, len(representatives))
+	for i, r := range representatives {
+		if grouped[i] {
+			continue
+		}
+		keep := images[r]
+		members := exact[keep.hashes.Sum]
+		for j := i + 1; j < len(representatives) && distance >= 0; j++ {
+			other := images[representatives[j]]
+			if !grouped[j] && imagetool.Distance(keep.perceptual(), other.perceptual()) <= distance {
+				grouped[j] = true
+				members = append(members, exact[other.hashes.Sum]...)
+			}
+		}
+		if len(members) < 2 {
+			continue
+		}
+		g := duplicateGroup{keep: keep}
+		for _, m := range members {
+			img := images[m]
+			if img.file == keep.file {
+				continue
+			}
+			g.duplicates = append(g.duplicates, duplicate{
+				hashedImage: img,
+				exact:       img.hashes.Sum == keep.hashes.Sum,
+				distance:    imagetool.Distance(img.perceptual(), keep.perceptual()),
+			})
+		}
+		sort.Slice(g.duplicates, func(i, j int) bool {
+			return g.duplicates[i].file < g.duplicates[j].file
+		})
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].keep.file < groups[j].keep.file
+	})
+	return groups
+}
+
+func resolveDuplicate(opts *options, keep hashedImage, d duplicate) error {
+	logger := opts.logger.With("path", d.file, "keep", keep.file)
+	switch dedupeFlags.action {
+	case "link":
+		keepStat, err := os.Stat(keep.file)
+		if err != nil {
+			return err
+		}
+		stat, err := os.Stat(d.file)
+		if err != nil {
+			return err
+		}
+		if os.SameFile(keepStat, stat) {
+			return nil
+		}
+		if err := fileutil.ReplaceWithLink(keep.file, d.file); err != nil {
+			return err
+		}
+		logger.Info("linked duplicate", "size", system.ByteSize(d.size))
+	case "move":
+		to, err := imagetool.MoveDuplicate(d.root, d.file)
+		if err != nil {
+			return err
+		}
+		logger.Info("moved duplicate", "to", to, "exact", d.exact, "distance", d.distance)
+	}
+	return nil
+}
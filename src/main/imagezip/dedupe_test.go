@@ -0,0 +1,101 @@
+package main
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/tool/imagetool"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func hashed(file string, sum byte, phash uint64, pixels int64) hashedImage {
+	h := hashedImage{entry: entry{file: file}, pixels: pixels}
+	h.hashes = imagetool.Hashes{PHash: phash}
+	h.hashes.Sum[0] = sum
+	return h
+}
+
+func TestGroupDuplicatesExact(t *testing.T) {
+	groups := groupDuplicates([]hashedImage{
+		hashed("b.jpg", 1, 0, 100),
+		hashed("a.jpg", 1, 0, 100),
+		hashed("c.jpg", 2, 0xffff, 100),
+	}, -1)
+	if len(groups) != 1 || groups[0].keep.file != "a.jpg" || len(groups[0].duplicates) != 1 {
+		t.Fatalf("groups = %+v", groups)
+	}
+	if d := groups[0].duplicates[0]; d.file != "b.jpg" || !d.exact {
+		t.Fatalf("duplicate = %+v", d)
+	}
+}
+
+func TestGroupDuplicatesDoesNotChain(t *testing.T) {
+	// A~B and B~C within 4 bits, A and C 6 bits apart
+	groups := groupDuplicates([]hashedImage{
+		hashed("a.jpg", 1, 0b000000, 300),
+		hashed("b.jpg", 2, 0b000111, 200),
+		hashed("c.jpg", 3, 0b111111, 100),
+	}, 4)
+	for _, g := range groups {
+		for _, d := range g.duplicates {
+			if d.distance > 4 {
+				t.Fatalf("%s grouped with %s at distance %d", d.file, g.keep.file, d.distance)
+			}
+		}
+	}
+	if len(groups) != 1 || groups[0].keep.file != "a.jpg" || len(groups[0].duplicates) != 1 || groups[0].duplicates[0].file != "b.jpg" {
+		t.Fatalf("groups = %+v", groups)
+	}
+}
+
+func TestGroupDuplicatesKeepsBest(t *testing.T) {
+	groups := groupDuplicates([]hashedImage{
+		hashed("small.jpg", 1, 0b1, 100),
+		hashed("large.jpg", 2, 0b0, 400),
+		hashed("large-copy.jpg", 2, 0b0, 400),
+	}, 2)
+	if len(groups) != 1 || groups[0].keep.file != "large-copy.jpg" || len(groups[0].duplicates) != 2 {
+		t.Fatalf("groups = %+v", groups)
+	}
+}
+
+func TestMoveDuplicateKeepsOutOfBackups(t *testing.T) {
+	root := t.TempDir()
+	keep, dup := filepath.Join(root, "a.jpg"), filepath.Join(root, "sub", "b.jpg")
+	for _, file := range []string{keep, dup} {
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("same"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := imagetool.NewBackupStore("zip", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &options{
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		backups:  backups,
+		failures: myerrors.NewSummary(),
+	}
+	action := dedupeFlags.action
+	dedupeFlags.action = "move"
+	defer func() { dedupeFlags.action = action }()
+	d := duplicate{hashedImage: hashedImage{entry: entry{root: root, file: dup}}, exact: true}
+	if err := resolveDuplicate(opts, hashedImage{entry: entry{root: root, file: keep}}, d); err != nil {
+		t.Fatal(err)
+	}
+	if err := backups.Close(); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(root, ".resize.dedupe", "sub", "b.jpg")
+	if _, err := os.Stat(moved); err != nil || !imagetool.IsDuplicatePath(moved) {
+		t.Fatalf("duplicate not moved to %s, %v", moved, err)
+	}
+	if found, err := backups.List(root); err != nil || len(found) != 0 {
+		t.Fatalf("backup store lists %v, %v, want no backups", found, err)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"ImageZipResize/tool/flatten"
+)
+
+var expandCommand = &command{
+	name:    "expand",
+	args:    "<directories or zip files...>",
+	summary: "move the flattened files of the directories or zips back to their original paths",
+	setup:   setupJournalFlags,
+	run: func(opts *options, args []string) error {
+		return runPlans(opts, args, "expanding", flatten.PlanExpand, flatten.PlanExpandZip)
+	},
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"ImageZipResize/tool/flatten"
+	"ImageZipResize/util"
+	"ImageZipResize/util/logging"
+	"ImageZipResize/util/progress"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var journalFlags struct {
+	resume bool
+	revert bool
+}
+
+var flattenFlags struct {
+	depth     int
+	keepTop   bool
+	delimiter string
+	escape    string
+}
+
+var flattenCommand = &command{
+	name:    "flatten",
+	args:    "<directories or zip files...>",
+	summary: "move every file of the directories or zips to the top level, encoding the path into the name",
+	setup: func(fs *flag.FlagSet) {
+		setupJournalFlags(fs)
+		fs.IntVar(&flattenFlags.depth, "depth", 0, "fold only the lowest directories of every file into its name, 0 folds all")
+		fs.BoolVar(&flattenFlags.keepTop, "keep-top", false, "keep the top directories below the arguments")
+		fs.StringVar(&flattenFlags.delimiter, "delimiter", flatten.DefaultScheme.Delimiter, "joins the folded directories, contains the escape once")
+		fs.StringVar(&flattenFlags.escape, "escape", flatten.DefaultScheme.Escape, "character doubled where it occurs in the folded directories")
+	},
+	run: runFlatten,
+}
+
+func runFlatten(opts *options, args []string) error {
+	options := flatten.Options{
+		Depth:   flattenFlags.depth,
+		KeepTop: flattenFlags.keepTop,
+		Scheme:  flatten.Scheme{Delimiter: flattenFlags.delimiter, Escape: flattenFlags.escape},
+	}
+	if options.Depth < 0 {
+		return usageErrorf("invalid depth %d", options.Depth)
+	}
+	if err := options.Scheme.Validate(); err != nil {
+		return usageErrorf("%v", err)
+	}
+	return runPlans(opts, args, "flattening", func(dir string) (*flatten.Plan, error) {
+		return flatten.PlanFlatten(dir, options)
+	}, func(zip string) (*flatten.Plan, error) {
+		return flatten.PlanFlattenZip(zip, options)
+	})
+}
+
+func setupJournalFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&journalFlags.resume, "resume", false, "finish an interrupted flatten or expand of the directories")
+	fs.BoolVar(&journalFlags.revert, "revert", false, "move back the files of an interrupted flatten or expand of the directories")
+}
+
+// runPlans plans the moves of every directory, or the renames of every zip,
+// prints them on a dry run and makes them otherwise. Directories and zips
+// with a conflict are left untouched.
+func runPlans(opts *options, args []string, verb string, planDir, planZip func(path string) (*flatten.Plan, error)) error {
+	zips, dirs, err := splitArgs(args)
+	if err != nil {
+		return err
+	}
+	for _, file := range zips {
+		if !strings.EqualFold(filepath.Ext(file), ".zip") {
+			return usageErrorf("directories or zip files expected, got %s", file)
+		}
+	}
+	switch {
+	case journalFlags.resume && journalFlags.revert:
+		return usageErrorf("--resume and --revert are exclusive")
+	case (journalFlags.resume || journalFlags.revert) && len(zips) > 0:
+		return usageErrorf("zip files are rewritten at once, there is nothing to resume or revert")
+	case journalFlags.resume:
+		verb, planDir = "resuming", flatten.PlanResume
+	case journalFlags.revert:
+		verb, planDir = "reverting", flatten.PlanRevert
+	}
+	paths := append(dirs, zips...)
+	for i, path := range paths {
+		plan := planDir
+		if i >= len(dirs) {
+			plan = planZip
+		}
+		opts.logger.Info(verb, "path", path)
+		p, err := plan(path)
+		if p != nil && opts.dryRun {
+			for _, m := range p.Moves {
+				fmt.Printf("would move %s -> %s\n", filepath.Join(path, m.From), filepath.Join(path, m.To))
+			}
+			fmt.Printf("%s: %d moves\n", path, len(p.Moves))
+		}
+		if err == nil && !opts.dryRun {
+			p.Workers = opts.parallelism()
+			stop := showMoves(opts, p)
+			err = p.Apply()
+			stop()
+		}
+		if err != nil {
+			opts.logger.Error(verb+" failed", "path", path, "error", err)
+			opts.failures.Add(path, err)
+		}
+	}
+	return nil
+}
+
+// showMoves draws the progress of the moves of the plan on a terminal, the
+// ETA is taken from the pace of the recent moves.
+func showMoves(opts *options, p *flatten.Plan) (stop func()) {
+	if len(p.Moves) == 0 || opts.logFormat != "text" || !progress.IsTerminal(os.Stdout) {
+		return func() {}
+	}
+	total := len(p.Moves)
+	var done atomic.Int64
+	window := util.NewTimeWindow(1000, time.Millisecond)
+	display := progress.New(os.Stdout, int64(total), func() time.Duration {
+		return (window.Average() * time.Duration(total-int(done.Load()))).Truncate(time.Second)
+	})
+	p.Progress = func(m flatten.Move, err error) {
+		window.Append(time.Now())
+		done.Add(1)
+		display.End(display.Begin(m.From), err != nil, 0, 0)
+	}
+	logging.SetConsole(display.Writer(os.Stderr))
+	display.Start()
+	return func() {
+		display.Stop()
+		logging.SetConsole(os.Stderr)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/tool/imagetool"
+	"ImageZipResize/util/fileutil"
+	"ImageZipResize/util/logging"
+	"ImageZipResize/util/system"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+type options struct {
+	jobs        int
+	memory      string
+	noParallel  bool
+	dryRun      bool
+	logLevel    string
+	logFormat   string
+	logFile     string
+	config      string
+	backupStore string
+	backupRoot  string
+
+	logger   *slog.Logger
+	backups  imagetool.BackupStore
+	failures *myerrors.Summary
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	setup   func(fs *flag.FlagSet)
+	run     func(opts *options, args []string) error
+}
+
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+func usageErrorf(format string, a ...any) error {
+	return usageError{message: fmt.Sprintf(format, a...)}
+}
+
+var commands = []*command{
+	resizeCommand,
+	watchCommand,
+	rollbackCommand,
+	backupCommand,
+	flattenCommand,
+	expandCommand,
+	renameDateCommand,
+	renameCommand,
+	verifyCommand,
+	statsCommand,
+	dedupeCommand,
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.jobs, "jobs", o.jobs, "number of parallel jobs, 0 to detect from cpu and memory")
+	fs.StringVar(&o.memory, "memory", o.memory, "total memory for all jobs like 4GiB, default is half of the available memory")
+	fs.BoolVar(&o.noParallel, "no-parallel", o.noParallel, "run jobs one by one, same as --jobs 1")
+	fs.BoolVar(&o.dryRun, "dry-run", o.dryRun, "print what would be done without changing any file")
+	fs.StringVar(&o.logLevel, "log-level", o.logLevel, "log level, debug, info, warn or error")
+	fs.StringVar(&o.logFormat, "log-format", o.logFormat, "log format, text or json")
+	fs.StringVar(&o.logFile, "log-file", o.logFile, "also append the log to this file")
+	fs.StringVar(&o.config, "config", o.config, "json file providing default flag values")
+	fs.StringVar(&o.backupStore, "backup-store", o.backupStore, "where originals are kept, tree, mirror, zip or tar")
+	fs.StringVar(&o.backupRoot, "backup-root", o.backupRoot, "directory of the mirror backup store")
+}
+
+func (o *options) apply() (io.Closer, error) {
+	level, err := logging.ParseLevel(o.logLevel)
+	if err != nil {
+		return nil, usageError{message: err.Error()}
+	}
+	logger, closer, err := logging.New(level, o.logFormat, o.logFile)
+	if err != nil {
+		return nil, usageError{message: err.Error()}
+	}
+	o.logger = logger
+	if err := o.applyResources(); err != nil {
+		closer.Close()
+		return nil, err
+	}
+	o.backups, err = imagetool.NewBackupStore(o.backupStore, o.backupRoot)
+	if err != nil {
+		closer.Close()
+		return nil, usageError{message: err.Error()}
+	}
+	return closer, nil
+}
+
+func (o *options) applyResources() error {
+	if o.memory != "" {
+		size, err := system.ParseByteSize(o.memory)
+		if err != nil || size == 0 {
+			return usageErrorf("invalid memory %q", o.memory)
+		}
+		system.SetMemory(size)
+	}
+	if o.jobs < 0 {
+		return usageErrorf("invalid jobs %d", o.jobs)
+	}
+	if o.noParallel {
+		o.logger.Info("run without parallel", "flag", "--no-parallel")
+		o.jobs = 1
+	}
+	if o.jobs > 0 {
+		system.SetParallelism(uint64(o.jobs))
+	}
+	return nil
+}
+
+func (o *options) parallelism() int {
+	return int(system.GetParallelism())
+}
+
+// throttled tells the resize workers follow the sampled resources, unless
+// their number or memory is given.
+func (o *options) throttled() bool {
+	return !o.noParallel && o.jobs == 0 && o.memory == ""
+}
+
+// loadConfig sets the flags which are not given on the command line from the config file.
+func loadConfig(fs *flag.FlagSet, file string, given map[string]bool) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]any)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("parse config %s failed, %w", file, err)
+	}
+	for name, value := range values {
+		if given[name] {
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			slog.Warn("unknown config key, ignored", "key", name, "config", file)
+			continue
+		}
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("config %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// parseInterleaved parses flags placed anywhere between the positional arguments.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func printUsage(global *flag.FlagSet) {
+	out := global.Output()
+	fmt.Fprintf(out, "Usage: imagezip [global flags] <command> [flags] <paths...>\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nGlobal flags:\n")
+	global.PrintDefaults()
+	fmt.Fprintf(out, "\nRun 'imagezip help <command>' for the flags of a command.\n")
+}
+
+func printCommandUsage(cmd *command, fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: imagezip %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+	fs.PrintDefaults()
+}
+
+func newCommandFlagSet(cmd *command, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	opts.register(fs)
+	if cmd.setup != nil {
+		cmd.setup(fs)
+	}
+	fs.Usage = func() { printCommandUsage(cmd, fs) }
+	return fs
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	opts := &options{logLevel: "info", logFormat: "text", backupStore: "tree", failures: myerrors.NewSummary()}
+	global := flag.NewFlagSet("imagezip", flag.ContinueOnError)
+	opts.register(global)
+	global.Usage = func() { printUsage(global) }
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	given := make(map[string]bool)
+	global.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	rest := global.Args()
+	if len(rest) == 0 {
+		printUsage(global)
+		return exitUsage
+	}
+	if rest[0] == "help" {
+		if len(rest) < 2 {
+			printUsage(global)
+			return exitOK
+		}
+		cmd := findCommand(rest[1])
+		if cmd == nil {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", rest[1])
+			return exitUsage
+		}
+		newCommandFlagSet(cmd, opts).Usage()
+		return exitOK
+	}
+	cmd := findCommand(rest[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", rest[0])
+		printUsage(global)
+		return exitUsage
+	}
+
+	fs := newCommandFlagSet(cmd, opts)
+	positional, err := parseInterleaved(fs, rest[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if opts.config != "" {
+		if err := loadConfig(fs, opts.config, given); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return exitUsage
+		}
+	}
+	closer, err := opts.apply()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return exitUsage
+	}
+	defer closer.Close()
+
+	err = cmd.run(opts, positional)
+	opts.failures.Add("", opts.backups.Close())
+	var usage usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		fs.Usage()
+		return exitUsage
+	}
+	opts.failures.Log(opts.logger)
+	if err != nil {
+		opts.logger.Error("command failed", "command", cmd.name, "error", strings.TrimSpace(err.Error()))
+		return exitFailure
+	}
+	if opts.failures.Count() > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// splitArgs separates the path arguments of a command into files and directories.
+func splitArgs(args []string) (files []string, dirs []string, err error) {
+	if len(args) == 0 {
+		return nil, nil, usageErrorf("no path given")
+	}
+	files, dirs, invalid := fileutil.SplitArgs(args)
+	if len(invalid) > 0 {
+		return nil, nil, usageErrorf("not a file or directory: %s", strings.Join(invalid, ", "))
+	}
+	return files, dirs, nil
+}
+
+// scanArgs expands the path arguments of a command into files, directories
+// which cannot be scanned are recorded as failures and skipped.
+func scanArgs(opts *options, args []string) ([]string, error) {
+	if _, _, err := splitArgs(args); err != nil {
+		return nil, err
+	}
+	files, err := fileutil.ScanArgs(args)
+	opts.failures.Add("", err)
+	return files, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"ImageZipResize/util/system"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// probe is a command which keeps the options and flag it ran with, and
+// fails as told.
+type probe struct {
+	opts    options
+	level   string
+	args    []string
+	err     error
+	failure error
+}
+
+func (p *probe) install(t *testing.T) {
+	t.Helper()
+	cmd := &command{
+		name: "probe",
+		setup: func(fs *flag.FlagSet) {
+			fs.StringVar(&p.level, "level", "low", "a flag of the command")
+		},
+		run: func(opts *options, args []string) error {
+			p.opts, p.args = *opts, args
+			opts.failures.Add("probe", p.failure)
+			return p.err
+		},
+	}
+	saved := commands
+	commands = append(commands[:len(commands):len(commands)], cmd)
+	par := system.GetParallelism()
+	t.Cleanup(func() {
+		commands = saved
+		system.SetParallelism(par)
+	})
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestRunFlagPrecedence(t *testing.T) {
+	config := writeConfig(t, `{"log-format": "json", "dry-run": true, "jobs": 3, "level": "high", "unknown": 1}`)
+	for _, tt := range []struct {
+		name   string
+		args   []string
+		format string
+		dryRun bool
+		jobs   int
+		level  string
+	}{
+		{name: "defaults", args: []string{"probe", "x"}, format: "text", level: "low"},
+		{name: "global", args: []string{"--log-format", "json", "--jobs", "2", "probe", "x"}, format: "json", jobs: 2, level: "low"},
+		{name: "command", args: []string{"probe", "--jobs", "2", "x", "--level", "mid"}, format: "text", jobs: 2, level: "mid"},
+		{name: "command over global", args: []string{"--jobs", "2", "probe", "--jobs", "4", "x"}, format: "text", jobs: 4, level: "low"},
+		{name: "no parallel", args: []string{"--jobs", "2", "probe", "--no-parallel", "x"}, format: "text", jobs: 1, level: "low"},
+		{name: "config", args: []string{"--config", config, "probe", "x"}, format: "json", dryRun: true, jobs: 3, level: "high"},
+		{name: "flags over config", args: []string{"--config", config, "--jobs", "2", "probe", "--log-format", "text", "--level", "mid", "x"},
+			format: "text", dryRun: true, jobs: 2, level: "mid"},
+		{name: "config of the command", args: []string{"probe", "--config", config, "--dry-run=false", "x"}, format: "json", jobs: 3, level: "high"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := new(probe)
+			p.install(t)
+			if code := run(tt.args); code != exitOK {
+				t.Fatalf("run = %d", code)
+			}
+			o := p.opts
+			if o.logFormat != tt.format || o.dryRun != tt.dryRun || o.jobs != tt.jobs || p.level != tt.level {
+				t.Errorf("log format %s, dry run %v, jobs %d, level %s, want %s, %v, %d, %s",
+					o.logFormat, o.dryRun, o.jobs, p.level, tt.format, tt.dryRun, tt.jobs, tt.level)
+			}
+			if len(p.args) != 1 || p.args[0] != "x" {
+				t.Errorf("args = %v", p.args)
+			}
+		})
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		err     error
+		failure error
+		want    int
+	}{
+		{name: "ok", args: []string{"probe", "x"}, want: exitOK},
+		{name: "help", args: []string{"help", "probe"}, want: exitOK},
+		{name: "help flag", args: []string{"probe", "-h"}, want: exitOK},
+		{name: "no command", args: []string{}, want: exitUsage},
+		{name: "unknown command", args: []string{"nope"}, want: exitUsage},
+		{name: "unknown flag", args: []string{"probe", "--nope", "x"}, want: exitUsage},
+		{name: "invalid value", args: []string{"--jobs", "-1", "probe", "x"}, want: exitUsage},
+		{name: "invalid config", args: []string{"--config", writeConfig(t, `{"jobs": "many"}`), "probe", "x"}, want: exitUsage},
+		{name: "missing config", args: []string{"--config", filepath.Join(t.TempDir(), "none.json"), "probe", "x"}, want: exitUsage},
+		{name: "usage error", args: []string{"probe", "x"}, err: usageErrorf("bad path"), want: exitUsage},
+		{name: "command error", args: []string{"probe", "x"}, err: errors.New("broken"), want: exitFailure},
+		{name: "failure", args: []string{"probe", "x"}, failure: errors.New("broken file"), want: exitFailure},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &probe{err: tt.err, failure: tt.failure}
+			p.install(t)
+			if code := run(tt.args); code != tt.want {
+				t.Errorf("run(%q) = %d, want %d", tt.args, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunNoParallel(t *testing.T) {
+	p := new(probe)
+	p.install(t)
+	system.SetParallelism(4)
+	if code := run([]string{"probe", "--no-parallel", "x"}); code != exitOK {
+		t.Fatalf("run = %d", code)
+	}
+	if par := system.GetParallelism(); par != 1 || system.GetMemoryLimit() != system.GetMemoryAvailable() {
+		t.Fatalf("parallelism %d with %s of %s memory, want one job with all of it",
+			par, system.GetMemoryLimit(), system.GetMemoryAvailable())
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"ImageZipResize/tool/flatten"
+	"ImageZipResize/tool/imagetool"
+	"ImageZipResize/tool/metadata"
+	"ImageZipResize/tool/rename"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/fileutil"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var renameFlags struct {
+	template   string
+	preset     string
+	dateSource string
+	ext        string
+	excludeExt string
+	undo       bool
+}
+
+var renameCommand = &command{
+	name:    "rename",
+	args:    "<files or directories...>",
+	summary: "rename files from a template of their date, camera and name, and undo it",
+	setup: func(fs *flag.FlagSet) {
+		fs.StringVar(&renameFlags.template, "template", "", "new path relative to the argument, like {date:2006/01/02}/{date:150405}_{camera}_{seq:04}{ext}")
+		fs.StringVar(&renameFlags.preset, "preset", "date-prefix", "template used without --template, "+strings.Join(rename.PresetNames(), ", "))
+		setupRenameFlags(fs)
+	},
+	run: func(opts *options, args []string) error {
+		preset, ok := rename.Presets[renameFlags.preset]
+		if !ok && renameFlags.template == "" {
+			return usageErrorf("unknown preset %q", renameFlags.preset)
+		}
+		if renameFlags.template != "" {
+			preset = rename.Preset{Template: renameFlags.template}
+		}
+		return runRename(opts, args, preset)
+	},
+}
+
+func setupRenameFlags(fs *flag.FlagSet) {
+	fs.StringVar(&renameFlags.dateSource, "date-source", "exif,quicktime,name,mtime", "where to take the date from, in order of priority")
+	fs.StringVar(&renameFlags.ext, "ext", "", "only rename files with these extensions, like jpg,png")
+	fs.StringVar(&renameFlags.excludeExt, "exclude-ext", "", "never rename files with these extensions")
+	fs.BoolVar(&renameFlags.undo, "undo", false, "revert the latest rename of the directories")
+}
+
+// runRename renames the files of the arguments by the preset, the files of a
+// directory argument relative to it and the other files in place.
+func runRename(opts *options, args []string, preset rename.Preset) error {
+	files, dirs, err := splitArgs(args)
+	if err != nil {
+		return err
+	}
+	if renameFlags.undo {
+		if len(files) > 0 {
+			return usageErrorf("directories expected to undo, got files: %v", files)
+		}
+		return undoRenames(opts, dirs)
+	}
+	template, err := rename.ParseTemplate(preset.Template)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	sources, err := metadata.ParseSources(renameFlags.dateSource)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	include, exclude := parseExts(renameFlags.ext), parseExts(renameFlags.excludeExt)
+
+	run := newRunID()
+	roots := make(map[string][]string)
+	for _, file := range files {
+		roots[filepath.Dir(file)] = append(roots[filepath.Dir(file)], file)
+	}
+	for _, dir := range dirs {
+		found, err := fileutil.ScanFiles(dir)
+		if err != nil {
+			opts.failures.Add(dir, err)
+			continue
+		}
+		roots[dir] = append(roots[dir], found...)
+	}
+	for root, paths := range roots {
+		candidates := make([]string, 0, len(paths))
+		for _, path := range paths {
+			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+			switch {
+			case isToolFile(path):
+			case len(include) > 0 && !include[ext], exclude[ext]:
+			case preset.Skip != nil && preset.Skip.MatchString(filepath.Base(path)):
+				opts.logger.Debug("already renamed", "path", path)
+			default:
+				candidates = append(candidates, path)
+			}
+		}
+		moves, err := rename.Plan(root, readFiles(opts, candidates, sources), template)
+		opts.failures.Add(root, err)
+		if opts.dryRun {
+			for _, m := range moves {
+				fmt.Printf("would rename %s -> %s\n", m.From, m.To)
+			}
+			fmt.Printf("%s: %d renames\n", root, len(moves))
+			continue
+		}
+		opts.logger.Info("renaming", "path", root, "run", run, "template", template, "files", len(moves))
+		opts.failures.Add(root, rename.Apply(root, run, moves, opts.parallelism()))
+	}
+	return nil
+}
+
+// readFiles reads the dates and the cameras of the files, the files without
+// date are recorded as failures and left out.
+func readFiles(opts *options, paths []string, sources []metadata.Source) []rename.File {
+	files := make([]rename.File, len(paths))
+	concurrent.ForEach(indexes(len(paths)), func(i int) {
+		f := rename.File{Path: paths[i]}
+		f.Meta, _ = metadata.Read(f.Path)
+		date, source, err := metadata.CaptureTime(f.Path, f.Meta, sources)
+		if err != nil {
+			opts.failures.Add(f.Path, err)
+		} else {
+			f.Time = date
+			opts.logger.Debug("capture date", "path", f.Path, "date", date, "source", source)
+		}
+		files[i] = f
+	}, opts.parallelism())
+	dated := files[:0]
+	for _, f := range files {
+		if !f.Time.IsZero() {
+			dated = append(dated, f)
+		}
+	}
+	return dated
+}
+
+// parseExts reads a list of extensions like jpg,.PNG into lower case without dots.
+func parseExts(value string) map[string]bool {
+	exts := make(map[string]bool)
+	for _, ext := range strings.Split(value, ",") {
+		if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" {
+			exts[ext] = true
+		}
+	}
+	return exts
+}
+
+func indexes(n int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = i
+	}
+	return values
+}
+
+// isToolFile tells the files this tool keeps for itself, backups, caches,
+// manifests and journals, which are never renamed.
+func isToolFile(path string) bool {
+	return imagetool.IsOriginBackupPath(path) || imagetool.IsDuplicatePath(path) || imagetool.IsBackupArchive(path) || imagetool.IsManifestPath(path) ||
+		fileutil.IsCachePath(path) || flatten.IsControlPath(path) || rename.IsJournalPath(path)
+}
+
+func undoRenames(opts *options, dirs []string) error {
+	for _, dir := range dirs {
+		run, moves, err := rename.PlanUndo(dir)
+		if err != nil {
+			opts.failures.Add(dir, err)
+			continue
+		}
+		if opts.dryRun {
+			for _, m := range moves {
+				fmt.Printf("would rename %s -> %s\n", m.From, m.To)
+			}
+			fmt.Printf("%s: %d renames of run %s to undo\n", dir, len(moves), run)
+			continue
+		}
+		opts.logger.Info("undoing rename", "path", dir, "run", run, "files", len(moves))
+		opts.failures.Add(dir, rename.Undo(dir))
+	}
+	return nil
+}
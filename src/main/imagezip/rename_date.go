@@ -0,0 +1,15 @@
+package main
+
+import (
+	"ImageZipResize/tool/rename"
+)
+
+var renameDateCommand = &command{
+	name:    "rename-date",
+	args:    "<files or directories...>",
+	summary: "prefix file names with their capture date, like 2006-01-02 name.jpg",
+	setup:   setupRenameFlags,
+	run: func(opts *options, args []string) error {
+		return runRename(opts, args, rename.Presets["date-prefix"])
+	},
+}
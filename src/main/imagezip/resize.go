@@ -0,0 +1,380 @@
+package main
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/tool/imagetool"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/fileutil"
+	"ImageZipResize/util/logging"
+	"ImageZipResize/util/progress"
+	"ImageZipResize/util/slices"
+	"ImageZipResize/util/system"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	slices_ "slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var resizeTarget = image.Pt(1440, 1440)
+
+type entry struct {
+	root    string
+	file    string
+	isCover bool
+	mem     system.ByteSize
+	info    imagetool.ImageInfo
+}
+
+func collect(logger *slog.Logger, files []string, dirs []string, failures *myerrors.Summary) ([]entry, map[string]struct{}) {
+	entries := make([]entry, 0)
+	roots := make(map[string]struct{})
+	slices.ForEach(files, func(file string) {
+		root := filepath.Dir(file)
+		roots[root] = struct{}{}
+		entries = append(entries, entry{root: root, file: file})
+	})
+	slices.ForEach(dirs, func(dir string) {
+		root := filepath.Dir(dir)
+		roots[root] = struct{}{}
+		found, err := fileutil.ScanFiles(dir)
+		if err != nil {
+			logger.Error("scan files failed", "path", dir, "error", err)
+			failures.Add(dir, err)
+			return
+		}
+		slices.ForEach(found, func(file string) {
+			entries = append(entries, entry{root: root, file: file})
+		})
+	})
+	return entries, roots
+}
+
+// isResizeCandidate tells the files resize picks up, images and archives which
+// are neither resized already nor backups.
+func isResizeCandidate(file string) bool {
+	if !imagetool.IsSupportedImageFilename(file) && !imagetool.IsSupportedArchiveFilename(file) {
+		return false
+	}
+	if imagetool.IsOriginBackupPath(file) || imagetool.IsDuplicatePath(file) || imagetool.IsBackupArchive(file) || fileutil.IsCachePath(file) {
+		return false
+	}
+	return !imagetool.IsResizedPath(file)
+}
+
+// arrange drops the files which are not resized and sorts the rest, the first
+// image of every directory is its cover.
+func arrange(entries []entry) []entry {
+	entries = slices.Filter(entries, func(e entry) bool {
+		return isResizeCandidate(e.file)
+	})
+	slices_.SortStableFunc(entries, func(left entry, right entry) int {
+		return strings.Compare(left.file, right.file)
+	})
+	covered := make(map[string]bool)
+	for i := range entries {
+		// archives have their own cover
+		if imagetool.IsSupportedArchiveFilename(entries[i].file) {
+			continue
+		}
+		if dir := filepath.Dir(entries[i].file); !covered[dir] {
+			entries[i].isCover = true
+			covered[dir] = true
+		}
+	}
+	return entries
+}
+
+var total int64 = 1
+var totalWidth = 1
+var indexAtomic = new(atomic.Int64)
+var doneAtomic = new(atomic.Int64)
+var estimator *progress.Estimator
+var limiter *concurrent.Limiter
+var retrying = new(atomic.Bool)
+var display *progress.Display
+
+var resizeCommand = &command{
+	name:    "resize",
+	args:    "<files or directories...>",
+	summary: "resize images and move the originals into .resize.backup",
+	run:     runResize,
+}
+
+func runResize(opts *options, args []string) error {
+	files, dirs, err := splitArgs(args)
+	if err != nil {
+		return err
+	}
+	logger := opts.logger
+	for _, dir := range dirs {
+		logger.Info("resize directory argument", "path", dir)
+	}
+	for _, file := range files {
+		logger.Info("resize file argument", "path", file)
+	}
+	entries, roots := collect(logger, files, dirs, opts.failures)
+	entries = arrange(entries)
+	defer func() {
+		for root := range roots {
+			os.RemoveAll(fileutil.GetCacheDir(root))
+		}
+	}()
+
+	par := system.GetParallelism()
+	memoryLimit := system.GetMemoryLimit()
+	memoryAvailable := system.GetMemoryAvailable()
+	entries = inspect(logger, entries, memoryLimit, memoryAvailable, opts.failures)
+
+	total = int64(len(entries))
+	totalWidth = len(fmt.Sprintf("%d", total))
+	indexAtomic.Store(0)
+	doneAtomic.Store(0)
+
+	if opts.dryRun {
+		for i, en := range entries {
+			cover := ""
+			if en.isCover {
+				cover = " (cover)"
+			}
+			if en.info.Images > 0 {
+				fmt.Printf("[%*d/%d] resize %s, %d images up to %dx%d, %s memory\n", totalWidth, i+1, total, en.file,
+					en.info.Images, en.info.Width, en.info.Height, en.mem)
+				continue
+			}
+			fmt.Printf("[%*d/%d] resize %s%s, %dx%d %d frames, %s memory\n", totalWidth, i+1, total, en.file, cover,
+				en.info.Width, en.info.Height, en.info.Frames, en.mem)
+		}
+		return nil
+	}
+
+	limiter = concurrent.NewLimiter(int64(memoryAvailable), int(par))
+	retrying.Store(false)
+	estimator = progress.NewEstimator(0.3, 200*time.Millisecond)
+	for _, en := range entries {
+		estimator.Plan(imageKind(en.info), en.info.Pixels())
+	}
+
+	if total == 0 {
+		return nil
+	}
+	defer time.Sleep(time.Second)
+
+	if progress.IsTerminal(os.Stdout) {
+		setTitle := func(title string, percent int64) {
+			progress.WriteTitle(os.Stdout, title, percent)
+		}
+		if opts.logFormat == "text" {
+			display = progress.New(os.Stdout, total, eta)
+			logging.SetConsole(display.Writer(os.Stderr))
+			display.Start()
+			defer func() {
+				display.Stop()
+				display = nil
+				logging.SetConsole(os.Stderr)
+			}()
+			setTitle = display.Title
+		}
+		stopTitleLoop := startUpdateTitleLoop(setTitle)
+		defer stopTitleLoop()
+	}
+
+	retryEntries := make([]entry, 0)
+	retryChan := make(chan entry, int(par))
+	doneChan := make(chan struct{})
+	go func() {
+		for entry := range retryChan {
+			retryEntries = append(retryEntries, entry)
+		}
+		close(doneChan)
+	}()
+
+	budget := newResizeBudget(int(par), memoryAvailable, limiter)
+	if opts.throttled() {
+		stopThrottle := startThrottle(logger, limiter, memoryLimit, budget.MaxWorkers)
+		defer stopThrottle()
+	}
+	run := newRunID()
+	logger.Info("resize images", "run", run, "total", total, "parallelism", par, "memory", memoryAvailable, "memoryLimit", memoryLimit)
+	concurrent.ForEachWeighted(entries, func(en entry) int64 {
+		return int64(en.mem)
+	}, budget, func(en entry) {
+		i := indexAtomic.Add(1)
+		tag := fmt.Sprintf("%*d/%d", totalWidth, i, total)
+		err := resize(logger, opts.backups, run, tag, en)
+		switch {
+		case err == nil:
+		case myerrors.IsResourceExhausted(err):
+			retryChan <- en
+		default:
+			opts.failures.Add(en.file, err)
+		}
+	})
+
+	close(retryChan)
+	<-doneChan
+
+	retries := int64(len(retryEntries))
+	if retries == 0 {
+		return nil
+	}
+
+	logger.Info("resize images exhausting resources sequentially", "total", retries, "memoryLimit", memoryAvailable)
+	retrying.Store(true)
+	for _, en := range retryEntries {
+		estimator.Plan(imageKind(en.info), en.info.Pixels())
+	}
+	retryBase := total - retries + 1
+	for i, en := range retryEntries {
+		tag := fmt.Sprintf("%*d/%d", totalWidth, retryBase+int64(i), total)
+		en.mem = memoryAvailable
+		opts.failures.Add(en.file, resize(logger, opts.backups, run, tag, en))
+	}
+	return nil
+}
+
+// newResizeBudget shares the memory among the resize workers, the throttle
+// adjusts it through the limiter.
+func newResizeBudget(par int, memoryAvailable system.ByteSize, limiter *concurrent.Limiter) concurrent.Budget {
+	return concurrent.Budget{
+		Limit:       int64(memoryAvailable),
+		Workers:     par,
+		MaxWorkers:  max(par, int(system.GetCpuCores())),
+		HugeWeight:  int64(memoryAvailable) / 4,
+		HugeWorkers: 1,
+		Limiter:     limiter,
+	}
+}
+
+// inspect reads the size of every image to estimate its memory usage, images
+// which cannot be inspected are recorded as failures and dropped. Archives
+// without images are dropped silently.
+func inspect(logger *slog.Logger, entries []entry, memoryLimit, memoryAvailable system.ByteSize, failures *myerrors.Summary) []entry {
+	errs := make([]error, len(entries))
+	indexes := make([]int, len(entries))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	concurrent.ForEach(indexes, func(i int) {
+		entries[i].info, errs[i] = imagetool.Inspect(entries[i].file)
+		mem := entries[i].info.EstimateMemory()
+		if images := entries[i].info.Images; images > 0 {
+			// the images of an archive are resized in parallel
+			mem *= system.ByteSize(min(images, int(system.GetParallelism())))
+		}
+		entries[i].mem = min(max(mem, memoryLimit), memoryAvailable)
+	}, int(system.GetParallelism()))
+	result := make([]entry, 0, len(entries))
+	for i, en := range entries {
+		if errors.Is(errs[i], myerrors.ErrNoArchiveImages) {
+			logger.Debug("skip archive without images", "path", en.file)
+			continue
+		}
+		if errs[i] != nil {
+			logger.Warn("skip image", "path", en.file, "error", errs[i])
+			failures.Add(en.file, errs[i])
+			continue
+		}
+		result = append(result, en)
+	}
+	return result
+}
+
+// newRunID names a resize run, it is recorded with the backups for rollback.
+func newRunID() string {
+	return fmt.Sprintf("%s-%04x", time.Now().Format("20060102-150405"), rand.IntN(0x10000))
+}
+
+func resize(logger *slog.Logger, backups imagetool.BackupStore, run string, tag string, en entry) error {
+	var size int64
+	if stat, err := os.Stat(en.file); err == nil {
+		size = stat.Size()
+	}
+	id := 0
+	if display != nil {
+		id = display.Begin(en.file)
+	}
+	start := time.Now()
+	logger = logger.With("path", en.file, "tag", tag)
+	result, err := imagetool.Resize(logger, backups, run, en.root, en.file, en.isCover, resizeTarget, imagetool.ModeContain.DoNotEnlarge(), en.mem)
+	if err != nil {
+		estimator.Skip(imageKind(en.info), en.info.Pixels())
+	} else {
+		estimator.Done(imageKind(en.info), en.info.Pixels(), time.Since(start))
+	}
+	if display != nil {
+		display.End(id, err != nil, size, int64(float64(size)*result))
+	}
+	if err != nil {
+		logger.Error("resize failed", "target", resizeTarget, "size", system.ByteSize(size), "duration", time.Since(start), "error", err, "eta", eta())
+		return err
+	}
+	doneAtomic.Add(1)
+	logger.Info("resized", "target", resizeTarget, "size", system.ByteSize(size), "rate", compressRate(result), "duration", time.Since(start), "eta", eta())
+	return nil
+}
+
+func compressRate(rate float64) string {
+	deltaPercent := (rate - 1) * 100
+	if deltaPercent == 0.0 {
+		return "-0%"
+	}
+	if deltaPercent < 0.0 {
+		return fmt.Sprintf("%.2f%%", deltaPercent)
+	}
+	return fmt.Sprintf("+%.2f%%", deltaPercent)
+}
+
+func eta() time.Duration {
+	workers := 1
+	if !retrying.Load() {
+		_, workers = limiter.Limit()
+	}
+	return estimator.Remaining(workers).Truncate(time.Second)
+}
+
+func imageKind(info imagetool.ImageInfo) string {
+	if info.IsAnimated() {
+		return "animated"
+	}
+	return "static"
+}
+
+// updateTitle shows the progress in the terminal title through setTitle,
+// which keeps it apart from the progress display.
+func updateTitle(setTitle func(title string, percent int64)) {
+	nextTime := time.Now().Add(100 * time.Millisecond)
+	done := doneAtomic.Load()
+	setTitle(fmt.Sprintf("[%d/%d] [ETA:%s] Image Resize", done, total, eta()), 100*done/total)
+	time.Sleep(nextTime.Sub(time.Now()))
+}
+
+func startUpdateTitleLoop(setTitle func(title string, percent int64)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	doneCh := make(chan struct{})
+	go updateTitleLoop(ctx, doneCh, setTitle)
+	return func() {
+		cancel()
+		<-doneCh
+	}
+}
+
+func updateTitleLoop(ctx context.Context, doneCh chan struct{}, setTitle func(title string, percent int64)) {
+	defer close(doneCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			updateTitle(setTitle)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"ImageZipResize/myerrors"
+	"archive/zip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectDropsArchivesWithoutImages(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "notes.cbz")
+	file, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(file)
+	dst, _ := w.Create("notes.txt")
+	dst.Write([]byte("notes"))
+	w.Close()
+	file.Close()
+	broken := filepath.Join(dir, "broken.jpg")
+	if err := os.WriteFile(broken, []byte("not a jpeg"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := myerrors.NewSummary()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	entries := inspect(logger, []entry{{root: dir, file: archive}, {root: dir, file: broken}}, 1<<20, 1<<30, failures)
+	if len(entries) != 0 {
+		t.Errorf("inspect() kept %v", entries)
+	}
+	if failures.Count() != 1 || failures.Skipped() != 0 {
+		t.Errorf("failures = %d and %d skipped, want only the broken image", failures.Count(), failures.Skipped())
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"ImageZipResize/tool/imagetool"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/slices"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var rollbackFlags struct {
+	run       string
+	since     string
+	until     string
+	match     string
+	worseThan float64
+}
+
+var rollbackCommand = &command{
+	name:    "rollback",
+	args:    "<files or directories...>",
+	summary: "restore the backed up originals and remove their resized images",
+	setup: func(fs *flag.FlagSet) {
+		fs.StringVar(&rollbackFlags.run, "run", "", "only restore the backups of the resize run")
+		fs.StringVar(&rollbackFlags.since, "since", "", "only restore the backups made since the date like 2024-01-31 or 2024-01-31T12:00")
+		fs.StringVar(&rollbackFlags.until, "until", "", "only restore the backups made until the date, inclusive")
+		fs.StringVar(&rollbackFlags.match, "match", "", "only restore the originals matching the glob, against the name or with a separator the path")
+		fs.Float64Var(&rollbackFlags.worseThan, "worse-than", 0, "only restore the images resized to more than the rate of their original size like 0.8")
+	},
+	run: runRollback,
+}
+
+type rollbackFilter struct {
+	run       string
+	since     time.Time
+	until     time.Time
+	match     string
+	worseThan float64
+}
+
+func newRollbackFilter() (rollbackFilter, error) {
+	f := rollbackFilter{run: rollbackFlags.run, match: rollbackFlags.match, worseThan: rollbackFlags.worseThan}
+	var err error
+	if rollbackFlags.since != "" {
+		if f.since, _, err = parseDate(rollbackFlags.since); err != nil {
+			return f, usageErrorf("invalid since %q", rollbackFlags.since)
+		}
+	}
+	if rollbackFlags.until != "" {
+		until, dateOnly, err := parseDate(rollbackFlags.until)
+		if err != nil {
+			return f, usageErrorf("invalid until %q", rollbackFlags.until)
+		}
+		if dateOnly {
+			until = until.AddDate(0, 0, 1)
+		}
+		f.until = until
+	}
+	if f.match != "" {
+		if _, err := filepath.Match(f.match, ""); err != nil {
+			return f, usageErrorf("invalid match %q", f.match)
+		}
+	}
+	if f.worseThan < 0 {
+		return f, usageErrorf("invalid rate %v", f.worseThan)
+	}
+	return f, nil
+}
+
+// parseDate parses a local date with an optional time, dateOnly tells that
+// the time is missing.
+func parseDate(value string) (t time.Time, dateOnly bool, err error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, false, nil
+		}
+	}
+	t, err = time.ParseInLocation("2006-01-02", value, time.Local)
+	return t, true, err
+}
+
+func (f rollbackFilter) accept(s backupStatus) bool {
+	if f.run != "" && (!s.recorded || s.record.Run != f.run) {
+		return false
+	}
+	if !f.since.IsZero() && s.time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !s.time.Before(f.until) {
+		return false
+	}
+	if f.match != "" {
+		name := filepath.Base(s.backup.Origin)
+		if strings.ContainsRune(f.match, filepath.Separator) || strings.ContainsRune(f.match, '/') {
+			name = s.backup.Origin
+		}
+		if ok, _ := filepath.Match(filepath.FromSlash(f.match), name); !ok {
+			return false
+		}
+	}
+	if f.worseThan > 0 && s.rate() <= f.worseThan {
+		return false
+	}
+	return true
+}
+
+func runRollback(opts *options, args []string) error {
+	if _, _, err := splitArgs(args); err != nil {
+		return err
+	}
+	filter, err := newRollbackFilter()
+	if err != nil {
+		return err
+	}
+	backups := make([]imagetool.Backup, 0)
+	for _, arg := range args {
+		found, err := opts.backups.List(arg)
+		opts.failures.Add(arg, err)
+		backups = append(backups, found...)
+	}
+	backups = slices.Filter(backups, func(b imagetool.Backup) bool {
+		return imagetool.IsSupportedImageFilename(b.Origin) || imagetool.IsSupportedArchiveFilename(b.Origin)
+	})
+	backups = latestBackups(opts.logger, backups)
+	statuses := slices.Filter(inspectBackups(opts, backups, false), filter.accept)
+	total := len(statuses)
+	if opts.dryRun {
+		for i, s := range statuses {
+			fmt.Printf("[%d/%d] rollback %s, run %s, %s, rate %.2f, remove %s\n",
+				i+1, total, s.backup.Origin, s.record.Run, s.time.Local().Format(time.DateTime), s.rate(), s.resized)
+		}
+		return nil
+	}
+	curr := new(atomic.Int64)
+	curr.Store(0)
+	concurrent.ForEach(statuses, func(s backupStatus) {
+		i := curr.Add(1)
+		tag := fmt.Sprintf("%d/%d", i, total)
+		opts.failures.Add(s.backup.Origin, rollback(opts.logger, opts.backups, tag, s))
+	}, opts.parallelism())
+	return nil
+}
+
+// latestBackups keeps the latest version of each origin, the older ones
+// would conflict with it and stay in the store.
+func latestBackups(logger *slog.Logger, backups []imagetool.Backup) []imagetool.Backup {
+	latest := make(map[string]int)
+	for i, b := range backups {
+		if j, ok := latest[b.Origin]; !ok || b.Version > backups[j].Version {
+			latest[b.Origin] = i
+		}
+	}
+	result := make([]imagetool.Backup, 0, len(latest))
+	for i, b := range backups {
+		if latest[b.Origin] != i {
+			logger.Info("keep older backup", "path", b.Origin, "version", b.Version)
+			continue
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+func rollback(logger *slog.Logger, backups imagetool.BackupStore, tag string, s backupStatus) error {
+	logger = logger.With("path", s.backup.Origin, "tag", tag)
+	start := time.Now()
+	err := imagetool.Rollback(logger, backups, s.backup, s.resized)
+	if err != nil {
+		logger.Error("rollback failed", "error", err)
+		return err
+	}
+	logger.Info("rollback", "run", s.record.Run, "duration", time.Since(start))
+	return nil
+}
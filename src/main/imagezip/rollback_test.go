@@ -0,0 +1,109 @@
+package main
+
+import (
+	"ImageZipResize/tool/imagetool"
+	"errors"
+	"testing"
+	"time"
+)
+
+func localTime(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", value, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseDate(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		want     time.Time
+		dateOnly bool
+		fails    bool
+	}{
+		{value: "2024-01-31", want: localTime("2024-01-31T00:00:00"), dateOnly: true},
+		{value: "2024-01-31T12:30", want: localTime("2024-01-31T12:30:00")},
+		{value: "2024-01-31 12:30", want: localTime("2024-01-31T12:30:00")},
+		{value: "2024-01-31T12:30:15", want: localTime("2024-01-31T12:30:15")},
+		{value: "2024-01-31T12:30:15Z", want: time.Date(2024, 1, 31, 12, 30, 15, 0, time.UTC)},
+		{value: "31.01.2024", fails: true},
+		{value: "2024-02-30", fails: true},
+	} {
+		got, dateOnly, err := parseDate(tt.value)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("parseDate(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) || dateOnly != tt.dateOnly {
+			t.Errorf("parseDate(%q) = %v, %v, %v, want %v, %v", tt.value, got, dateOnly, err, tt.want, tt.dateOnly)
+		}
+	}
+}
+
+func TestRollbackFilter(t *testing.T) {
+	status := func(run string, at string) backupStatus {
+		s := backupStatus{backup: imagetool.Backup{Origin: "a/b.jpg"}, time: localTime(at)}
+		if run != "" {
+			s.record, s.recorded = imagetool.Record{Run: run}, true
+		}
+		return s
+	}
+	early := status("run1", "2024-01-31T00:00:00")
+	late := status("run1", "2024-01-31T23:59:59")
+	next := status("run2", "2024-02-01T00:00:00")
+	unrecorded := status("", "2024-01-31T12:00:00")
+	for _, tt := range []struct {
+		name  string
+		run   string
+		since string
+		until string
+		want  []bool
+	}{
+		{name: "none", want: []bool{true, true, true, true}},
+		{name: "run", run: "run1", want: []bool{true, true, false, false}},
+		{name: "since date", since: "2024-01-31", want: []bool{true, true, true, true}},
+		{name: "since time", since: "2024-01-31T12:00", want: []bool{false, true, true, true}},
+		// a date only until includes the whole day
+		{name: "until date", until: "2024-01-31", want: []bool{true, true, false, true}},
+		{name: "until time", until: "2024-01-31T12:00", want: []bool{true, false, false, false}},
+		{name: "since and until date", since: "2024-01-31", until: "2024-01-31", want: []bool{true, true, false, true}},
+		{name: "run and until", run: "run2", until: "2024-01-31", want: []bool{false, false, false, false}},
+		{name: "run and since", run: "run2", since: "2024-02-01", want: []bool{false, false, true, false}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := rollbackFlags
+			defer func() { rollbackFlags = flags }()
+			rollbackFlags.run, rollbackFlags.since, rollbackFlags.until = tt.run, tt.since, tt.until
+			f, err := newRollbackFilter()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, s := range []backupStatus{early, late, next, unrecorded} {
+				if got := f.accept(s); got != tt.want[i] {
+					t.Errorf("accept(%s at %s) = %v, want %v", s.record.Run, s.time, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRollbackFilterInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		since string
+		until string
+	}{
+		{since: "yesterday"},
+		{until: "2024-13-01"},
+	} {
+		flags := rollbackFlags
+		rollbackFlags.since, rollbackFlags.until = tt.since, tt.until
+		_, err := newRollbackFilter()
+		rollbackFlags = flags
+		if !errors.As(err, new(usageError)) {
+			t.Errorf("newRollbackFilter(since %q, until %q) = %v, want a usage error", tt.since, tt.until, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"ImageZipResize/tool/imagetool"
+	"ImageZipResize/util/fileutil"
+	"ImageZipResize/util/system"
+	"fmt"
+	"os"
+)
+
+var statsCommand = &command{
+	name:    "stats",
+	args:    "<files or directories...>",
+	summary: "count pending, resized and backed up images with their sizes",
+	run:     runStats,
+}
+
+type statsCounter struct {
+	count int
+	size  int64
+}
+
+func (c *statsCounter) add(size int64) {
+	c.count++
+	c.size += size
+}
+
+func runStats(opts *options, args []string) error {
+	files, err := scanArgs(opts, args)
+	if err != nil {
+		return err
+	}
+	var pending, resized, backups, others statsCounter
+	for _, arg := range args {
+		found, er := opts.backups.List(arg)
+		opts.failures.Add(arg, er)
+		for _, b := range found {
+			backups.add(b.Size)
+		}
+	}
+	for _, file := range files {
+		stat, er := os.Stat(file)
+		if er != nil {
+			continue
+		}
+		switch {
+		case fileutil.IsCachePath(file):
+		case imagetool.IsOriginBackupPath(file), imagetool.IsDuplicatePath(file), imagetool.IsBackupArchive(file), imagetool.IsManifestPath(file):
+		case !imagetool.IsSupportedImageFilename(file) && !imagetool.IsSupportedArchiveFilename(file):
+			others.add(stat.Size())
+		case imagetool.IsResizedPath(file):
+			resized.add(stat.Size())
+		default:
+			pending.add(stat.Size())
+		}
+	}
+	fmt.Printf("%-10s %8s %12s\n", "kind", "files", "size")
+	for _, row := range []struct {
+		name    string
+		counter statsCounter
+	}{
+		{"pending", pending},
+		{"resized", resized},
+		{"backups", backups},
+		{"others", others},
+	} {
+		fmt.Printf("%-10s %8d %12s\n", row.name, row.counter.count, system.ByteSize(row.counter.size))
+	}
+	if backups.size > 0 {
+		fmt.Printf("resized images take %.2f%% of the backed up size\n", 100*float64(resized.size)/float64(backups.size))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/system"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	throttleInterval = 2 * time.Second
+	// swapping faster than this means the jobs do not fit in memory any more
+	throttleSwapRate = system.ByteSize(1024 * 1024)
+	throttleIdleCpu  = 80.0
+)
+
+// throttle adjusts the limits of the resize workers to the sampled resources:
+// it keeps half of the available memory free, removes a worker while the system
+// is swapping and adds one while cpu is idle and memory allows.
+type throttle struct {
+	logger     *slog.Logger
+	limiter    *concurrent.Limiter
+	minWeight  int64
+	maxWorkers int
+}
+
+func (t *throttle) update(r system.Resources) {
+	weight, count := t.limiter.Limit()
+	usedWeight, _ := t.limiter.Used()
+	headroom := int64(r.MemoryAvailable / 2)
+	newWeight := max(t.minWeight, usedWeight+headroom)
+	newCount := count
+	reason := ""
+	switch {
+	case r.SwapRate > throttleSwapRate && count > 1:
+		newCount = count - 1
+		reason = "swapping"
+	case r.CpuLoad < throttleIdleCpu && count < t.maxWorkers && headroom >= t.minWeight:
+		newCount = count + 1
+		reason = "cpu idle"
+	}
+	changed := newCount != count || newWeight < weight*9/10 || newWeight > weight*11/10
+	if !changed {
+		return
+	}
+	t.limiter.SetLimit(newWeight, newCount)
+	if reason == "" {
+		reason = "memory changed"
+	}
+	t.logger.Info("throttle", "reason", reason, "parallelism", fmt.Sprintf("%d -> %d", count, newCount),
+		"memory", fmt.Sprintf("%s -> %s", system.ByteSize(weight), system.ByteSize(newWeight)), "resources", r)
+}
+
+func startThrottle(logger *slog.Logger, limiter *concurrent.Limiter, minWeight system.ByteSize, maxWorkers int) func() {
+	t := &throttle{logger: logger, limiter: limiter, minWeight: int64(minWeight), maxWorkers: maxWorkers}
+	monitor := system.NewMonitor(throttleInterval)
+	monitor.Start(t.update)
+	return monitor.Stop
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/tool/imagetool"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/fileutil"
+	"ImageZipResize/util/slices"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+)
+
+var verifyCommand = &command{
+	name:    "verify",
+	args:    "<files or directories...>",
+	summary: "decode every resized image, check its size and pair it with its backup",
+	run:     runVerify,
+}
+
+func runVerify(opts *options, args []string) error {
+	files, err := scanArgs(opts, args)
+	if err != nil {
+		return err
+	}
+	files = slices.Filter(files, func(file string) bool {
+		return (imagetool.IsSupportedImageFilename(file) || imagetool.IsSupportedArchiveFilename(file)) && imagetool.IsResizedPath(file) &&
+			!imagetool.IsOriginBackupPath(file) && !imagetool.IsDuplicatePath(file) && !fileutil.IsCachePath(file)
+	})
+	backups := make([]imagetool.Backup, 0)
+	for _, arg := range args {
+		found, err := opts.backups.List(arg)
+		opts.failures.Add(arg, err)
+		backups = append(backups, found...)
+	}
+	backups = slices.Filter(backups, func(b imagetool.Backup) bool {
+		return imagetool.IsSupportedImageFilename(b.Origin) || imagetool.IsSupportedArchiveFilename(b.Origin)
+	})
+	statuses := inspectBackups(opts, latestBackups(opts.logger, backups), false)
+	paired := make(map[string]bool)
+	var orphans int
+	for _, s := range statuses {
+		if s.resized == "" {
+			orphans++
+			opts.failures.Add(backupName(s.backup), myerrors.ErrOrphanBackup)
+			continue
+		}
+		paired[absPath(s.resized)] = true
+	}
+
+	manifests := imagetool.NewManifests()
+	total := len(files)
+	curr := new(atomic.Int64)
+	var broken, mismatched, missing, unpaired atomic.Int64
+	concurrent.ForEach(files, func(file string) {
+		tag := fmt.Sprintf("%d/%d", curr.Add(1), total)
+		logger := opts.logger.With("path", file, "tag", tag)
+		if err := imagetool.Verify(file); err != nil {
+			broken.Add(1)
+			opts.failures.Add(file, err)
+			logger.Error("broken", "error", err)
+			return
+		}
+		record, recorded := manifests.LookupResized(file)
+		if recorded && !record.Kept {
+			info, err := imagetool.Inspect(file)
+			if err == nil {
+				err = imagetool.VerifyTarget(info, record.Target)
+			}
+			if err != nil {
+				mismatched.Add(1)
+				opts.failures.Add(file, err)
+				logger.Error("size mismatch", "target", record.Target, "error", err)
+			}
+		}
+		switch {
+		case paired[absPath(file)], recorded && record.Kept:
+		case recorded:
+			missing.Add(1)
+			opts.failures.Add(file, myerrors.ErrMissingBackup)
+			logger.Error("missing backup", "run", record.Run)
+		default:
+			unpaired.Add(1)
+			opts.failures.Add(file, myerrors.ErrOrphanResized)
+			logger.Error("resized image without backup or record")
+		}
+	}, opts.parallelism())
+	fmt.Printf("verified %d resized images, %d broken, %d size mismatched, %d missing backups, %d unpaired\n",
+		total, broken.Load(), mismatched.Load(), missing.Load(), unpaired.Load())
+	fmt.Printf("verified %d backups, %d orphans without resized image\n", len(statuses), orphans)
+	return nil
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/tool/imagetool"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/fileutil"
+	"ImageZipResize/util/filters"
+	"ImageZipResize/util/system"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	watchSettleTime     = 2 * time.Second
+	watchPollInterval   = 500 * time.Millisecond
+	watchStatusInterval = time.Minute
+)
+
+type pendingFile struct {
+	lastEvent time.Time
+	size      int64
+	modTime   time.Time
+}
+
+type watcher struct {
+	fs      *fsnotify.Watcher
+	dirs    []string
+	mutex   sync.Mutex
+	pending map[string]*pendingFile
+	running map[string]bool
+	// ready holds the settled files until the worker takes them, wake tells
+	// it there are some.
+	ready []string
+	wake  chan struct{}
+
+	run      string
+	logger   *slog.Logger
+	backups  imagetool.BackupStore
+	failures *myerrors.Summary
+
+	resized atomic.Int64
+	failed  atomic.Int64
+	// unflushed tells the backup store has work since the last flush
+	unflushed atomic.Bool
+}
+
+var watchCommand = &command{
+	name:    "watch",
+	args:    "<directories...>",
+	summary: "keep running and resize new or modified images under the directories",
+	run:     runWatch,
+}
+
+func runWatch(opts *options, args []string) error {
+	files, dirs, err := splitArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		return usageErrorf("watch accepts directories only")
+	}
+	if opts.dryRun {
+		return usageErrorf("watch does not support --dry-run")
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher failed, %w", err)
+	}
+	defer fsw.Close()
+
+	par := system.GetParallelism()
+	memoryLimit := system.GetMemoryLimit()
+	memoryAvailable := system.GetMemoryAvailable()
+	w := &watcher{
+		fs:       fsw,
+		run:      newRunID(),
+		logger:   opts.logger,
+		backups:  opts.backups,
+		failures: opts.failures,
+		pending:  make(map[string]*pendingFile),
+		running:  make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		w.dirs = append(w.dirs, dir)
+		if err := w.addTree(dir); err != nil {
+			w.logger.Error("watch directory failed", "path", dir, "error", err)
+			continue
+		}
+		w.logger.Info("watch directory argument", "path", dir)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer func() {
+		for _, dir := range w.dirs {
+			os.RemoveAll(fileutil.GetCacheDir(filepath.Dir(dir)))
+		}
+	}()
+
+	w.logger.Info("watch directories", "run", w.run, "total", len(w.dirs), "parallelism", par, "memoryLimit", memoryLimit)
+	limiter := concurrent.NewLimiter(int64(memoryAvailable), int(par))
+	budget := newResizeBudget(int(par), memoryAvailable, limiter)
+	if opts.throttled() {
+		stopThrottle := startThrottle(w.logger, limiter, memoryLimit, budget.MaxWorkers)
+		defer stopThrottle()
+	}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		w.drain(ctx, budget, memoryLimit, memoryAvailable)
+	}()
+
+	w.loop(ctx)
+	<-drained
+	w.logger.Info("watch stopped", "resized", w.resized.Load(), "failed", w.failed.Load())
+	return nil
+}
+
+func (w *watcher) loop(ctx context.Context) {
+	poll := time.NewTicker(watchPollInterval)
+	defer poll.Stop()
+	status := time.NewTicker(watchStatusInterval)
+	defer status.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Error("watch error", "error", err)
+		case <-poll.C:
+			w.dispatch()
+			w.flush()
+		case <-status.C:
+			w.mutex.Lock()
+			pending, running := len(w.pending), len(w.running)
+			w.mutex.Unlock()
+			w.logger.Info("watching", "directories", len(w.dirs), "pending", pending, "running", running,
+				"resized", w.resized.Load(), "failed", w.failed.Load())
+		}
+	}
+}
+
+// flush lets the backup store finish its work once nothing is pending or
+// running, so archived originals do not wait for the end of the watch.
+func (w *watcher) flush() {
+	w.mutex.Lock()
+	idle := len(w.pending) == 0 && len(w.running) == 0
+	w.mutex.Unlock()
+	if !idle || !w.unflushed.Swap(false) {
+		return
+	}
+	if err := w.backups.Flush(); err != nil {
+		w.failures.Add("", err)
+		w.logger.Error("flush backups failed", "error", err)
+	}
+}
+
+func (w *watcher) handle(event fsnotify.Event) {
+	if isIgnoredWatchPath(event.Name) {
+		return
+	}
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		w.mutex.Lock()
+		delete(w.pending, event.Name)
+		w.mutex.Unlock()
+		return
+	}
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+	if filters.PathIsDirectory(event.Name) {
+		if event.Has(fsnotify.Create) {
+			if err := w.addTree(event.Name); err != nil {
+				w.logger.Error("watch directory failed", "path", event.Name, "error", err)
+			}
+		}
+		return
+	}
+	w.touch(event.Name)
+}
+
+func (w *watcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			w.touch(path)
+			return nil
+		}
+		if isIgnoredWatchPath(path) {
+			return filepath.SkipDir
+		}
+		return w.fs.Add(path)
+	})
+}
+
+func (w *watcher) touch(file string) {
+	if !isResizeCandidate(file) {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if p, ok := w.pending[file]; ok {
+		p.lastEvent = time.Now()
+		return
+	}
+	w.pending[file] = &pendingFile{lastEvent: time.Now(), size: -1}
+}
+
+// dispatch hands the pending files which have not changed during the settle
+// time to the worker, without waiting for it.
+func (w *watcher) dispatch() {
+	now := time.Now()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for file, p := range w.pending {
+		if now.Sub(p.lastEvent) < watchSettleTime || w.running[file] {
+			continue
+		}
+		stat, err := os.Stat(file)
+		if err != nil || !stat.Mode().IsRegular() {
+			delete(w.pending, file)
+			continue
+		}
+		if stat.Size() != p.size || !stat.ModTime().Equal(p.modTime) {
+			p.size, p.modTime, p.lastEvent = stat.Size(), stat.ModTime(), now
+			continue
+		}
+		delete(w.pending, file)
+		w.running[file] = true
+		w.ready = append(w.ready, file)
+	}
+	if len(w.ready) > 0 {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// drain resizes the ready files a batch at a time like resize does, weighted
+// by their memory within the budget, until ctx is done.
+func (w *watcher) drain(ctx context.Context, budget concurrent.Budget, memoryLimit, memoryAvailable system.ByteSize) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		}
+		w.mutex.Lock()
+		ready := w.ready
+		w.ready = nil
+		w.mutex.Unlock()
+		entries := make([]entry, 0, len(ready))
+		for _, file := range ready {
+			entries = append(entries, entry{root: w.rootOf(file), file: file, isCover: isCoverFile(file)})
+		}
+		failures := w.failures.Count()
+		entries = inspect(w.logger, entries, memoryLimit, memoryAvailable, w.failures)
+		w.failed.Add(int64(w.failures.Count() - failures))
+		w.mutex.Lock()
+		for _, file := range ready {
+			delete(w.running, file)
+		}
+		for _, en := range entries {
+			w.running[en.file] = true
+		}
+		w.mutex.Unlock()
+		concurrent.ForEachWeighted(entries, func(en entry) int64 {
+			return int64(en.mem)
+		}, budget, w.resize)
+	}
+}
+
+func (w *watcher) resize(en entry) {
+	logger := w.logger.With("path", en.file, "tag", "watch")
+	start := time.Now()
+	result, err := imagetool.Resize(logger, w.backups, w.run, en.root, en.file, en.isCover, resizeTarget, imagetool.ModeContain.DoNotEnlarge(), en.mem)
+	w.mutex.Lock()
+	delete(w.running, en.file)
+	w.mutex.Unlock()
+	if errors.Is(err, myerrors.ErrNoArchiveImages) {
+		logger.Debug("skip archive without images")
+		return
+	}
+	if err != nil {
+		w.failed.Add(1)
+		w.failures.Add(en.file, err)
+		logger.Error("resize failed", "target", resizeTarget, "duration", time.Since(start), "error", err)
+		return
+	}
+	w.resized.Add(1)
+	w.unflushed.Store(true)
+	logger.Info("resized", "target", resizeTarget, "rate", compressRate(result), "duration", time.Since(start).Truncate(time.Millisecond))
+}
+
+func (w *watcher) rootOf(file string) string {
+	best := ""
+	for _, dir := range w.dirs {
+		if len(dir) > len(best) && (file == dir || strings.HasPrefix(file, dir+fileutil.Separator)) {
+			best = dir
+		}
+	}
+	if best == "" {
+		return filepath.Dir(file)
+	}
+	return filepath.Dir(best)
+}
+
+func isIgnoredWatchPath(path string) bool {
+	return imagetool.IsOriginBackupPath(path) || imagetool.IsDuplicatePath(path) || fileutil.IsCachePath(path)
+}
+
+// isCoverFile arranges the files of the directory like resize does, so that
+// both pick the same cover.
+func isCoverFile(file string) bool {
+	dir := filepath.Dir(file)
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	entries := make([]entry, 0, len(items))
+	for _, item := range items {
+		if item.Type().IsRegular() {
+			entries = append(entries, entry{file: filepath.Join(dir, item.Name())})
+		}
+	}
+	for _, en := range arrange(entries) {
+		if en.file == filepath.Clean(file) {
+			return en.isCover
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/util/concurrent"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArrangeCovers(t *testing.T) {
+	entries := arrange([]entry{
+		{file: "a/b/z.jpg"},
+		{file: "a/b/c/1.jpg"},
+		{file: "a/b/1.jpg"},
+		{file: "a/b/0.resized.webp"},
+		{file: "a/b/.resize.backup/0.jpg"},
+		{file: "a/b/book.cbz"},
+		{file: "a/b/notes.txt"},
+	})
+	covers := make(map[string]bool)
+	for _, en := range entries {
+		covers[en.file] = en.isCover
+	}
+	want := map[string]bool{"a/b/1.jpg": true, "a/b/c/1.jpg": true, "a/b/z.jpg": false, "a/b/book.cbz": false}
+	if len(covers) != len(want) {
+		t.Fatalf("arranged %v, want %v", covers, want)
+	}
+	for file, cover := range want {
+		if c, ok := covers[file]; !ok || c != cover {
+			t.Errorf("%s cover = %v, %v, want %v", file, c, ok, cover)
+		}
+	}
+}
+
+func TestIsCoverFileMatchesArrange(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.jpg", "a.resized.webp", "c.png", "A.png", "book.cbz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]bool{"A.png": true, "b.jpg": false, "c.png": false, "book.cbz": false} {
+		if got := isCoverFile(filepath.Join(dir, name)); got != want {
+			t.Errorf("isCoverFile(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestWatchDispatchDoesNotWait(t *testing.T) {
+	dir := t.TempDir()
+	w := &watcher{
+		dirs:     []string{dir},
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		failures: myerrors.NewSummary(),
+		pending:  make(map[string]*pendingFile),
+		running:  make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+	files := make([]string, 0)
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte("not a jpeg"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+		w.touch(file)
+	}
+	// the first poll after the settle time records the size, the next one
+	// finds it unchanged, no worker is running
+	for i := 0; i < 2; i++ {
+		for _, p := range w.pending {
+			p.lastEvent = time.Now().Add(-watchSettleTime)
+		}
+		w.dispatch()
+	}
+	if len(w.ready) != len(files) || len(w.pending) != 0 || len(w.wake) != 1 {
+		t.Fatalf("ready %v, pending %d, wake %d", w.ready, len(w.pending), len(w.wake))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		w.drain(ctx, concurrent.Budget{Limit: 1 << 30, Workers: 2}, 1<<20, 1<<30)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for w.failed.Load() < int64(len(files)) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-drained
+	if w.failed.Load() != int64(len(files)) || w.failures.Count() != len(files) {
+		t.Fatalf("failed %d and %d failures, want %d", w.failed.Load(), w.failures.Count(), len(files))
+	}
+	if len(w.running) != 0 || len(w.ready) != 0 {
+		t.Fatalf("running %v and ready %v after the batch", w.running, w.ready)
+	}
+}
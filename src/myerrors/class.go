@@ -0,0 +1,76 @@
+package myerrors
+
+import (
+	"errors"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+var resourceMessages = []string{
+	"cache resources exhausted",
+	"memory allocation failed",
+	"resource limit",
+	"unable to extend cache",
+}
+
+type Class string
+
+const (
+	ClassDecode         Class = "decode error"
+	ClassResource       Class = "resource exhausted"
+	ClassMagick         Class = "magick error"
+	ClassRenameConflict Class = "rename conflict"
+	ClassPermission     Class = "permission denied"
+	ClassNotFound       Class = "file not found"
+	ClassSkipped        Class = "skipped"
+	ClassIntegrity      Class = "integrity"
+	ClassOther          Class = "other"
+)
+
+var classOrder = []Class{ClassDecode, ClassResource, ClassMagick, ClassRenameConflict, ClassPermission, ClassNotFound, ClassSkipped, ClassIntegrity, ClassOther}
+
+func Classify(err error) Class {
+	var magickErr *MagickError
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, ErrDecode), errors.Is(err, ErrNotImage):
+		return ClassDecode
+	case IsResourceExhausted(err):
+		return ClassResource
+	case errors.As(err, &magickErr), errors.As(err, &exitErr), errors.Is(err, exec.ErrNotFound):
+		return ClassMagick
+	case errors.Is(err, ErrRenameConflict), errors.Is(err, ErrBackupConflict), errors.Is(err, ErrAmbiguousPath), errors.Is(err, fs.ErrExist):
+		return ClassRenameConflict
+	case errors.Is(err, fs.ErrPermission):
+		return ClassPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return ClassNotFound
+	case errors.Is(err, ErrAlreadyResized), errors.Is(err, ErrNotBackup), errors.Is(err, ErrNoMetadata),
+		errors.Is(err, ErrNoArchiveImages):
+		return ClassSkipped
+	case errors.Is(err, ErrSizeMismatch), errors.Is(err, ErrOrphanBackup), errors.Is(err, ErrMissingBackup),
+		errors.Is(err, ErrOrphanResized):
+		return ClassIntegrity
+	}
+	return ClassOther
+}
+
+// IsResourceExhausted reports whether magick failed for lack of memory or disk,
+// including being killed by a signal, so that the job may succeed with more resources.
+func IsResourceExhausted(err error) bool {
+	var magickErr *MagickError
+	if !errors.As(err, &magickErr) {
+		return false
+	}
+	if magickErr.ExitCode < 0 {
+		return true
+	}
+	stderr := strings.ToLower(magickErr.Stderr)
+	for _, message := range resourceMessages {
+		if strings.Contains(stderr, message) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,57 @@ package myerrors
 
 import (
 	"errors"
+	"fmt"
 )
 
 var ErrNotDirectory = errors.New("path is not directory")
+var ErrRenameConflict = errors.New("rename target already exists")
+var ErrDecode = errors.New("cannot decode image")
+var ErrNotBackup = errors.New("file is not a backup")
+var ErrNotImage = errors.New("file is not an image")
+var ErrAlreadyResized = errors.New("file is already resized")
+var ErrBackupConflict = errors.New("backup already exists")
+var ErrSizeMismatch = errors.New("image size does not match the resize target")
+var ErrOrphanBackup = errors.New("backup has no resized image")
+var ErrMissingBackup = errors.New("resized image has no backup")
+var ErrOrphanResized = errors.New("resized image has no backup or record")
+var ErrAmbiguousPath = errors.New("flattened path is ambiguous")
+var ErrUnfinishedJournal = errors.New("unfinished flatten or expand")
+var ErrNoMetadata = errors.New("no capture date in metadata")
+var ErrNoArchiveImages = errors.New("archive has no images")
+
+// MagickError is returned when the magick command exits with a non-zero code.
+type MagickError struct {
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *MagickError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("magick exit code %d", e.ExitCode)
+	}
+	return fmt.Sprintf("magick exit code %d, %s", e.ExitCode, e.Stderr)
+}
+
+func (e *MagickError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned when an image of a known format cannot be decoded.
+type DecodeError struct {
+	Format string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode %s image failed, %s", e.Format, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrDecode
+}
@@ -0,0 +1,97 @@
+package myerrors
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+type Failure struct {
+	Path string
+	Err  error
+}
+
+// Summary collects the failures of a command grouped by their Class, skipped
+// files are kept apart and do not count as failures.
+type Summary struct {
+	mutex    sync.Mutex
+	failures map[Class][]Failure
+	count    int
+	skipped  int
+}
+
+func NewSummary() *Summary {
+	return &Summary{failures: make(map[Class][]Failure)}
+}
+
+func (s *Summary) Add(path string, err error) {
+	if err == nil {
+		return
+	}
+	if merr, ok := err.(*multierror.Error); ok {
+		for _, e := range merr.WrappedErrors() {
+			s.Add(path, e)
+		}
+		return
+	}
+	class := Classify(err)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[class] = append(s.failures[class], Failure{Path: path, Err: err})
+	if class == ClassSkipped {
+		s.skipped++
+		return
+	}
+	s.count++
+}
+
+// Count returns the number of failures, without the skipped files.
+func (s *Summary) Count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+func (s *Summary) Skipped() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.skipped
+}
+
+// Log writes the count of skipped files at info and their paths at debug,
+// then every failure by its class.
+func (s *Summary) Log(logger *slog.Logger) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.skipped > 0 {
+		logger.Info("skipped", "count", s.skipped)
+		for _, f := range s.failures[ClassSkipped] {
+			logger.Debug("skip", "path", f.Path, "error", f.Err)
+		}
+	}
+	if s.count == 0 {
+		return
+	}
+	logger.Warn("failures", "count", s.count)
+	for _, class := range classOrder {
+		failures := s.failures[class]
+		if len(failures) == 0 || class == ClassSkipped {
+			continue
+		}
+		logger.Warn("failure class", "class", class, "count", len(failures))
+		for _, f := range failures {
+			logger.Warn("failure", "class", class, "path", f.Path, "error", f.Err)
+		}
+	}
+}
+
+// Err returns an error if any failure has been added.
+func (s *Summary) Err() error {
+	count := s.Count()
+	if count == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d failures", count)
+}
@@ -0,0 +1,77 @@
+package myerrors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+func TestSummarySkippedIsNotFailure(t *testing.T) {
+	s := NewSummary()
+	s.Add("a.jpg", ErrAlreadyResized)
+	s.Add("b.jpg", fmt.Errorf("resize b.jpg, %w", ErrNoMetadata))
+	s.Add("c.jpg", nil)
+	if s.Count() != 0 || s.Skipped() != 2 {
+		t.Fatalf("count %d skipped %d, want 0 and 2", s.Count(), s.Skipped())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("Err() = %v, want nil", err)
+	}
+	s.Add("d.jpg", multierror.Append(ErrSizeMismatch, errors.New("other"), ErrNotBackup))
+	if s.Count() != 2 || s.Skipped() != 3 {
+		t.Fatalf("count %d skipped %d, want 2 and 3", s.Count(), s.Skipped())
+	}
+	if s.Err() == nil {
+		t.Fatal("Err() = nil with failures")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, c := range []struct {
+		err   error
+		class Class
+	}{
+		{ErrNotImage, ClassDecode},
+		{&DecodeError{Format: "png", Err: errors.New("bad")}, ClassDecode},
+		{&MagickError{ExitCode: 1, Stderr: "cache resources exhausted"}, ClassResource},
+		{&MagickError{ExitCode: 1, Stderr: "no decode delegate"}, ClassMagick},
+		{ErrRenameConflict, ClassRenameConflict},
+		{ErrNoArchiveImages, ClassSkipped},
+		{ErrMissingBackup, ClassIntegrity},
+		{errors.New("other"), ClassOther},
+	} {
+		if got := Classify(c.err); got != c.class {
+			t.Errorf("Classify(%v) = %s, want %s", c.err, got, c.class)
+		}
+	}
+}
+
+func TestSummaryLogLevels(t *testing.T) {
+	s := NewSummary()
+	s.Add("a.jpg", ErrAlreadyResized)
+	s.Add("b.jpg", ErrAlreadyResized)
+	s.Add("c.jpg", ErrRenameConflict)
+	for _, tt := range []struct {
+		level slog.Level
+		want  []string
+	}{
+		{slog.LevelInfo, []string{"level=INFO msg=skipped count=2", "level=WARN msg=failures count=1", "path=c.jpg"}},
+		{slog.LevelDebug, []string{"level=INFO msg=skipped count=2", "level=DEBUG msg=skip path=a.jpg", "level=DEBUG msg=skip path=b.jpg", "path=c.jpg"}},
+	} {
+		out := new(bytes.Buffer)
+		s.Log(slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: tt.level})))
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("log at %s misses %q:\n%s", tt.level, want, out)
+			}
+		}
+		if tt.level == slog.LevelInfo && strings.Contains(out.String(), "a.jpg") {
+			t.Errorf("log at info lists the skipped paths:\n%s", out)
+		}
+	}
+}
@@ -2,52 +2,63 @@ package flatten
 
 import (
 	"ImageZipResize/util/fileutil"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"sync"
-
-	"github.com/hashicorp/go-multierror"
 )
 
-var deflateCache map[string]bool
-var deflateLock sync.Mutex
-
-func Expand(dir string) (err error) {
-	deflateLock.Lock()
-	defer deflateLock.Unlock()
-	deflateCache = make(map[string]bool)
-	files, err := fileutil.ScanFiles(dir)
+// Expand moves the flattened files of dir back to their original paths. The
+// mapping written by Flatten is preferred, only without one the paths are
+// decoded from the names with the scheme of the marker.
+func Expand(dir string) error {
+	plan, err := PlanExpand(dir)
 	if err != nil {
 		return err
 	}
-	for _, file := range files {
-		if er := expand(dir, file); er != nil {
-			err = multierror.Append(err, er)
-		}
-	}
-	return err
+	return plan.Apply()
 }
 
-func expand(dir string, file string) error {
-	oldRel, err := filepath.Rel(dir, file)
+func PlanExpand(dir string) (*Plan, error) {
+	if err := checkNoJournal(dir); err != nil {
+		return nil, err
+	}
+	moves, mapped, err := readMapping(dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	newRel, changed := expandPath(oldRel)
-	target := filepath.Join(dir, newRel)
-	if !changed {
-		log.Printf("not changed %s to %s", file, target)
-		return nil
+	scheme, _, err := readScheme(dir)
+	if err != nil {
+		return nil, err
 	}
-	targetDir := filepath.Dir(target)
-	if _, ok := deflateCache[targetDir]; !ok {
-		err := os.MkdirAll(targetDir, 0777)
+	plan := &Plan{Dir: dir, op: opExpand, scheme: scheme}
+	if mapped {
+		for _, m := range moves {
+			if _, err := os.Lstat(filepath.Join(dir, m.From)); err != nil {
+				slog.Warn("flattened file is gone", "path", filepath.Join(dir, m.From), "error", err)
+				continue
+			}
+			plan.Moves = append(plan.Moves, m)
+		}
+		return plan, plan.check(nil)
+	}
+	files, err := fileutil.ScanFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		oldRel, err := filepath.Rel(dir, file)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if isControlFile(oldRel) {
+			continue
+		}
+		newRel, changed := scheme.expandPath(oldRel)
+		if !changed {
+			slog.Debug("not changed", "path", file)
+			continue
 		}
-		deflateCache[targetDir] = true
+		plan.Moves = append(plan.Moves, Move{From: oldRel, To: newRel})
 	}
-	log.Printf("moving %s to %s", file, target)
-	return os.Rename(file, target)
+	return plan, plan.check(nil)
 }
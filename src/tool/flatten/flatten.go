@@ -2,37 +2,66 @@ package flatten
 
 import (
 	files2 "ImageZipResize/util/fileutil"
-	"log"
-	"os"
+	"log/slog"
 	"path/filepath"
-
-	"github.com/hashicorp/go-multierror"
 )
 
-func Flatten(dir string) (err error) {
-	files, err := files2.ScanFiles(dir)
+// Options of a flatten. Only the lowest Depth directories of every file are
+// folded into its name, all of them for 0, and the top directory stays with
+// KeepTop.
+type Options struct {
+	Depth   int
+	KeepTop bool
+	Scheme  Scheme
+}
+
+// Flatten moves every file below dir to its top level. All targets are checked
+// before anything moves and recorded in the mapping, see Expand.
+func Flatten(dir string, options Options) error {
+	plan, err := PlanFlatten(dir, options)
 	if err != nil {
 		return err
 	}
-	for _, file := range files {
-		if er := flatten(dir, file); er != nil {
-			err = multierror.Append(err, er)
-		}
-	}
-	return err
+	return plan.Apply()
 }
 
-func flatten(dir string, file string) error {
-	oldRel, err := filepath.Rel(dir, file)
+func PlanFlatten(dir string, options Options) (*Plan, error) {
+	if err := options.Scheme.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkNoJournal(dir); err != nil {
+		return nil, err
+	}
+	if err := checkScheme(dir, options.Scheme); err != nil {
+		return nil, err
+	}
+	mapped, _, err := readMapping(dir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	flattened := make(map[string]bool, len(mapped))
+	for _, m := range mapped {
+		flattened[m.From] = true
+	}
+	files, err := files2.ScanFiles(dir)
+	if err != nil {
+		return nil, err
 	}
-	newRel, changed := flattenPath(oldRel)
-	target := filepath.Join(dir, newRel)
-	if !changed {
-		log.Printf("not changed %s to %s", file, target)
-		return nil
+	plan := &Plan{Dir: dir, op: opFlatten, scheme: options.Scheme}
+	for _, file := range files {
+		oldRel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		if isControlFile(oldRel) || flattened[oldRel] {
+			continue
+		}
+		newRel, changed := options.Scheme.flattenPath(oldRel, keepLevels(oldRel, options.Depth, options.KeepTop))
+		if !changed {
+			slog.Debug("not changed", "path", file)
+			continue
+		}
+		plan.Moves = append(plan.Moves, Move{From: oldRel, To: newRel})
 	}
-	log.Printf("moving %s to %s", file, target)
-	return os.Rename(file, target)
+	return plan, plan.check(options.Scheme.expandPath)
 }
@@ -0,0 +1,153 @@
+package flatten
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/util/fileutil"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func writeTree(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		file := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(path), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the content of the files below dir by their relative path,
+// writeTree writes their original path into them.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files, err := fileutil.ScanFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := make(map[string]string, len(files))
+	for _, file := range files {
+		rel, _ := filepath.Rel(dir, file)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree[filepath.ToSlash(rel)] = string(data)
+	}
+	return tree
+}
+
+// checkTree compares the files below dir with want, and checks that the
+// files are back at their original path when restored.
+func checkTree(t *testing.T, dir string, restored bool, want ...string) {
+	t.Helper()
+	tree := readTree(t, dir)
+	got := make([]string, 0, len(tree))
+	for rel, content := range tree {
+		if restored && rel != content {
+			t.Errorf("%s holds %s", rel, content)
+		}
+		got = append(got, rel)
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("files = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFlattenExpand(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{"top.jpg", "a/b/c.jpg", "a/README", "a#b/d.png"}
+	writeTree(t, dir, paths...)
+	if err := Flatten(dir, Options{Scheme: DefaultScheme}); err != nil {
+		t.Fatal(err)
+	}
+	tree := readTree(t, dir)
+	for _, want := range []string{"top.flatten.jpg", "a-#-b-#-c.flatten.jpg", "a-#-README.flatten", "a##b-#-d.flatten.png", mappingName, schemeName} {
+		if _, ok := tree[want]; !ok {
+			t.Errorf("%s missing after flatten, got %v", want, tree)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Errorf("empty directory left, %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, journalName)); !os.IsNotExist(err) {
+		t.Errorf("journal left, %v", err)
+	}
+
+	if err := Expand(dir); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, true, paths...)
+}
+
+func TestExpandWithoutMapping(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{"a/b/c.jpg", "a/README", "x/y.png"}
+	writeTree(t, dir, paths...)
+	scheme := Scheme{Delimiter: "_@_", Escape: "@"}
+	if err := Flatten(dir, Options{Depth: 1, Scheme: scheme}); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, false, "a/b_@_c.flatten.jpg", "a_@_README.flatten", "x_@_y.flatten.png", mappingName, schemeName)
+	if err := os.Remove(filepath.Join(dir, mappingName)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Expand(dir); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, true, paths...)
+}
+
+func TestFlattenConflict(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, "a/b.jpg", "a-#-b.flatten.jpg")
+	_, err := PlanFlatten(dir, Options{Scheme: DefaultScheme})
+	if !errors.Is(err, myerrors.ErrRenameConflict) {
+		t.Fatalf("PlanFlatten() error = %v, want %v", err, myerrors.ErrRenameConflict)
+	}
+	checkTree(t, dir, true, "a/b.jpg", "a-#-b.flatten.jpg")
+}
+
+func TestFlattenOtherScheme(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, "a/b.jpg", "c/d.jpg")
+	if err := Flatten(dir, Options{Scheme: DefaultScheme}); err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, "e/f.jpg")
+	_, err := PlanFlatten(dir, Options{Scheme: Scheme{Delimiter: "_@_", Escape: "@"}})
+	if !errors.Is(err, myerrors.ErrAmbiguousPath) {
+		t.Fatalf("PlanFlatten() error = %v, want %v", err, myerrors.ErrAmbiguousPath)
+	}
+}
+
+func TestSchemeValidate(t *testing.T) {
+	for _, s := range []Scheme{
+		{Delimiter: "-#-", Escape: "##"},
+		{Delimiter: "---", Escape: "#"},
+		{Delimiter: "#", Escape: "#"},
+		{Delimiter: "-#-#", Escape: "#"},
+		{Delimiter: ".#.", Escape: "#"},
+		{Delimiter: "/#", Escape: "#"},
+	} {
+		if s.Validate() == nil {
+			t.Errorf("%+v is valid", s)
+		}
+	}
+	if err := DefaultScheme.Validate(); err != nil {
+		t.Error(err)
+	}
+}
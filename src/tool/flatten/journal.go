@@ -0,0 +1,135 @@
+package flatten
+
+import (
+	"ImageZipResize/myerrors"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// journalName is the file at the top of a directory listing the moves of a
+// flatten or expand in progress, written before the first move.
+const journalName = ".flatten.journal.jsonl"
+
+type journalEntry struct {
+	Op   string `json:"op,omitempty"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+func isControlFile(rel string) bool {
+	return rel == mappingName || rel == journalName || rel == schemeName
+}
+
+// IsControlPath tells the mapping, journal and scheme files kept by flatten.
+func IsControlPath(file string) bool {
+	return isControlFile(filepath.Base(file))
+}
+
+func checkNoJournal(dir string) error {
+	_, err := os.Lstat(filepath.Join(dir, journalName))
+	if err == nil {
+		return fmt.Errorf("%w in %s, resume or revert it first", myerrors.ErrUnfinishedJournal, dir)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func writeJournal(dir, op string, moves []Move) error {
+	file, err := os.OpenFile(filepath.Join(dir, journalName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	entries := make([]journalEntry, 0, len(moves)+1)
+	entries = append(entries, journalEntry{Op: op})
+	for _, m := range moves {
+		entries = append(entries, journalEntry{From: filepath.ToSlash(m.From), To: filepath.ToSlash(m.To)})
+	}
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readJournal(dir string) (op string, moves []Move, err error) {
+	file, err := os.Open(filepath.Join(dir, journalName))
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return "", nil, fmt.Errorf("journal %s, %w", file.Name(), err)
+		}
+		if e.Op != "" {
+			op = e.Op
+			continue
+		}
+		moves = append(moves, Move{From: filepath.FromSlash(e.From), To: filepath.FromSlash(e.To)})
+	}
+	if op != opFlatten && op != opExpand {
+		return "", nil, fmt.Errorf("journal %s has unknown operation %q", file.Name(), op)
+	}
+	return op, moves, scanner.Err()
+}
+
+// PlanResume plans the moves an interrupted flatten or expand of dir has left.
+func PlanResume(dir string) (*Plan, error) {
+	op, moves, err := readJournal(dir)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Dir: dir, op: op, journal: moves}
+	for _, m := range moves {
+		if exists(filepath.Join(dir, m.From)) {
+			plan.Moves = append(plan.Moves, m)
+		} else if !exists(filepath.Join(dir, m.To)) {
+			slog.Warn("journaled file is gone", "path", filepath.Join(dir, m.From))
+		}
+	}
+	return plan, plan.check(nil)
+}
+
+// PlanRevert plans moving back the files an interrupted flatten or expand of
+// dir has already moved.
+func PlanRevert(dir string) (*Plan, error) {
+	op, moves, err := readJournal(dir)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Dir: dir, op: op, journal: moves, revert: true}
+	for i := len(moves) - 1; i >= 0; i-- {
+		if exists(filepath.Join(dir, moves[i].To)) {
+			plan.Moves = append(plan.Moves, moves[i].inverse())
+		}
+	}
+	return plan, plan.check(nil)
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
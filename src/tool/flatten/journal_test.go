@@ -0,0 +1,121 @@
+package flatten
+
+import (
+	"ImageZipResize/myerrors"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// interrupt applies the first of the moves of a flatten of dir, as if it was
+// interrupted, and returns the flattened paths.
+func interrupt(t *testing.T, dir string) []string {
+	t.Helper()
+	plan, err := PlanFlatten(dir, Options{Scheme: DefaultScheme})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeScheme(dir, plan.scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendMapping(dir, plan.Moves); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJournal(dir, plan.op, plan.Moves); err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.move(plan.Moves[0]); err != nil {
+		t.Fatal(err)
+	}
+	flat := make([]string, 0, len(plan.Moves))
+	for _, m := range plan.Moves {
+		flat = append(flat, filepath.ToSlash(m.To))
+	}
+	return flat
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, "a/b.jpg", "a/c.jpg", "d/e.jpg")
+	flat := interrupt(t, dir)
+	if _, err := PlanFlatten(dir, Options{Scheme: DefaultScheme}); !errors.Is(err, myerrors.ErrUnfinishedJournal) {
+		t.Fatalf("PlanFlatten() error = %v, want %v", err, myerrors.ErrUnfinishedJournal)
+	}
+
+	plan, err := PlanResume(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Moves) != 2 {
+		t.Fatalf("resume moves = %v, want the 2 left", plan.Moves)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, false, append(flat, mappingName, schemeName)...)
+
+	if err := Expand(dir); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, true, "a/b.jpg", "a/c.jpg", "d/e.jpg")
+}
+
+func TestRevert(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, "a/b.jpg", "a/c.jpg", "d/e.jpg")
+	interrupt(t, dir)
+
+	plan, err := PlanRevert(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Moves) != 1 {
+		t.Fatalf("revert moves = %v, want the 1 made", plan.Moves)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, true, "a/b.jpg", "a/c.jpg", "d/e.jpg")
+}
+
+func TestRevertExpand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, "a/b.jpg", "d/e.jpg")
+	if err := Flatten(dir, Options{Scheme: DefaultScheme}); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanExpand(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJournal(dir, plan.op, plan.Moves); err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.move(plan.Moves[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	revert, err := PlanRevert(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := revert.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, false, "a-#-b.flatten.jpg", "d-#-e.flatten.jpg", mappingName, schemeName)
+	if err := Expand(dir); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, true, "a/b.jpg", "d/e.jpg")
+}
+
+func TestReadJournalUnknownOperation(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, journalName), []byte(`{"op":"shuffle"}`+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlanResume(dir); err == nil {
+		t.Fatal("PlanResume() of an unknown operation succeeded")
+	}
+}
@@ -0,0 +1,108 @@
+package flatten
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// mappingName is the file at the top of a flattened directory recording the
+// original path of every flattened file, so that expanding is an exact inverse.
+const mappingName = ".flatten.map.jsonl"
+
+type mapping struct {
+	Flat string `json:"flat"`
+	Path string `json:"path"`
+}
+
+// readMapping returns the moves back to the original paths, the latest entry
+// of a flattened file wins. It returns false when the directory has no mapping.
+func readMapping(dir string) ([]Move, bool, error) {
+	file, err := os.Open(filepath.Join(dir, mappingName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	moves, err := decodeMapping(file)
+	return moves, true, err
+}
+
+func decodeMapping(r io.Reader) ([]Move, error) {
+	moves := make([]Move, 0)
+	indexes := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var m mapping
+		if json.Unmarshal(scanner.Bytes(), &m) != nil || m.Flat == "" || m.Path == "" {
+			continue
+		}
+		move := Move{From: filepath.FromSlash(m.Flat), To: filepath.FromSlash(m.Path)}
+		if i, ok := indexes[move.From]; ok {
+			moves[i] = move
+			continue
+		}
+		indexes[move.From] = len(moves)
+		moves = append(moves, move)
+	}
+	return moves, scanner.Err()
+}
+
+// appendMapping records the moves of a flatten before they are made.
+func appendMapping(dir string, moves []Move) error {
+	if len(moves) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(filepath.Join(dir, mappingName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	if err := encodeMapping(file, moves); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// encodeMapping writes the entries of flattening moves.
+func encodeMapping(w io.Writer, moves []Move) error {
+	buffer := bufio.NewWriter(w)
+	for _, m := range moves {
+		data, err := json.Marshal(mapping{Flat: filepath.ToSlash(m.To), Path: filepath.ToSlash(m.From)})
+		if err != nil {
+			return err
+		}
+		buffer.Write(append(data, '\n'))
+	}
+	return buffer.Flush()
+}
+
+// dropMapping removes the entries of the expanded moves from the mapping,
+// and the mapping itself when none are left.
+func dropMapping(dir string, expanded []Move) error {
+	moves, mapped, err := readMapping(dir)
+	if err != nil || !mapped {
+		return err
+	}
+	done := make(map[Move]bool, len(expanded))
+	for _, m := range expanded {
+		done[m] = true
+	}
+	left := make([]Move, 0, len(moves))
+	for _, m := range moves {
+		if !done[m] {
+			left = append(left, m.inverse())
+		}
+	}
+	path := filepath.Join(dir, mappingName)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return appendMapping(dir, left)
+}
@@ -8,29 +8,99 @@ import (
 
 const tag = ".flatten"
 const delimiter = "-#-"
+const escape = "#"
 
-func flattenPath(path string) (result string, changed bool) {
+// flattenPath folds the directories of path after the first keep ones into
+// its name. Files at their final level which carry the tag are taken as
+// already flattened, others are tagged again so that they expand back to
+// their own name.
+func (s Scheme) flattenPath(path string, keep int) (result string, changed bool) {
 	ext := filepath.Ext(path)
-	if strings.HasSuffix(path, tag+ext) {
+	parts := fileutil.SplitPath(path)
+	if keep > len(parts)-1 {
+		keep = len(parts) - 1
+	}
+	if _, tagged := untag(parts[len(parts)-1]); tagged && keep == len(parts)-1 {
 		return
 	}
-	result = path
-	result = strings.ReplaceAll(result, "#", "##")
-	result = strings.ReplaceAll(result, fileutil.Separator, delimiter)
-	result = strings.TrimSuffix(result, ext) + tag + ext
+	folded := parts[keep:]
+	folded[len(folded)-1] = strings.TrimSuffix(folded[len(folded)-1], ext)
+	for i, part := range folded {
+		folded[i] = s.escape(part)
+	}
+	name := strings.Join(folded, s.Delimiter) + tag + s.escape(ext)
+	result = filepath.Join(append(parts[:keep:keep], name)...)
 	changed = true
 	return
 }
 
-func expandPath(path string) (result string, changed bool) {
-	ext := filepath.Ext(path)
-	if !strings.HasSuffix(path, tag+ext) {
+// expandPath unfolds the directories encoded in the name of path, its
+// directory is kept as is.
+func (s Scheme) expandPath(path string) (result string, changed bool) {
+	dir, name := filepath.Split(path)
+	name, tagged := untag(name)
+	if !tagged {
 		return
 	}
-	result = path
-	result = strings.TrimSuffix(result, tag+ext) + ext
-	result = strings.ReplaceAll(result, delimiter, fileutil.Separator)
-	result = strings.ReplaceAll(result, "##", "#")
+	// a doubled escape is a literal one, the escape of a delimiter is the
+	// first of an odd run as escapes of the next name follow it
+	at := strings.Index(s.Delimiter, s.Escape)
+	var b strings.Builder
+	for i := 0; i < len(name); {
+		switch {
+		case strings.HasPrefix(name[i:], s.Escape+s.Escape):
+			b.WriteString(s.Escape)
+			i += 2 * len(s.Escape)
+		case strings.HasPrefix(name[i:], s.Delimiter) && s.escapeRun(name[i+at:])%2 == 1:
+			b.WriteString(fileutil.Separator)
+			i += len(s.Delimiter)
+		default:
+			b.WriteByte(name[i])
+			i++
+		}
+	}
+	result = dir + b.String()
 	changed = true
 	return
 }
+
+// untag removes the tag from a name, it is in front of the extension or at the
+// end of a name without one.
+func untag(name string) (string, bool) {
+	if strings.HasSuffix(name, tag) {
+		return strings.TrimSuffix(name, tag), true
+	}
+	ext := filepath.Ext(name)
+	if strings.HasSuffix(name, tag+ext) {
+		return strings.TrimSuffix(name, tag+ext) + ext, true
+	}
+	return name, false
+}
+
+func (s Scheme) escape(part string) string {
+	return strings.ReplaceAll(part, s.Escape, s.Escape+s.Escape)
+}
+
+func (s Scheme) escapeRun(name string) int {
+	n := 0
+	for strings.HasPrefix(name, s.Escape) {
+		name = name[len(s.Escape):]
+		n++
+	}
+	return n
+}
+
+// keepLevels is how many directories of path stay when only its lowest depth
+// ones are folded, all of them are folded for a depth of 0. The top one stays
+// with keepTop.
+func keepLevels(path string, depth int, keepTop bool) int {
+	dirs := len(fileutil.SplitPath(path)) - 1
+	keep := 0
+	if depth > 0 && dirs > depth {
+		keep = dirs - depth
+	}
+	if keepTop && keep < 1 {
+		keep = 1
+	}
+	return keep
+}
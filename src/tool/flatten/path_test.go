@@ -0,0 +1,150 @@
+package flatten
+
+import (
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+func TestFlattenPath(t *testing.T) {
+	tests := []struct {
+		path string
+		keep int
+		want string
+	}{
+		{"a/b/c.jpg", 0, "a-#-b-#-c.flatten.jpg"},
+		{"a/b/c.jpg", 1, "a/b-#-c.flatten.jpg"},
+		{"a/b/c.jpg", 5, "a/b/c.flatten.jpg"},
+		{"sub/README", 0, "sub-#-README.flatten"},
+		{"a#b/c.jpg", 0, "a##b-#-c.flatten.jpg"},
+		{"x.flatten", 0, ""},
+		{"d.flatten.jpg", 0, ""},
+	}
+	for _, test := range tests {
+		path := filepath.FromSlash(test.path)
+		got, changed := DefaultScheme.flattenPath(path, test.keep)
+		if want := filepath.FromSlash(test.want); got != want || changed != (test.want != "") {
+			t.Errorf("flattenPath(%q, %d) = %q, %v, want %q", test.path, test.keep, got, changed, want)
+		}
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"a-#-b-#-c.flatten.jpg", "a/b/c.jpg"},
+		{"a/b-#-c.flatten.jpg", "a/b/c.jpg"},
+		{"sub-#-README.flatten", "sub/README"},
+		{"a##b-#-c.flatten.jpg", "a#b/c.jpg"},
+		{"a##-#-##b.flatten", "a#/#b"},
+		{"plain.jpg", ""},
+	}
+	for _, test := range tests {
+		got, changed := DefaultScheme.expandPath(filepath.FromSlash(test.path))
+		if want := filepath.FromSlash(test.want); got != want || changed != (test.want != "") {
+			t.Errorf("expandPath(%q) = %q, %v, want %q", test.path, got, changed, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, path := range []string{
+		"sub/README",
+		"a/b/c",
+		"a.b/c",
+		"sub/x.flatten",
+		"sub/.hidden",
+		"a#/#b/c##.jpg",
+		"a-#-b/c.jpg",
+	} {
+		path = filepath.FromSlash(path)
+		flat, _ := DefaultScheme.flattenPath(path, 0)
+		if back, _ := DefaultScheme.expandPath(flat); back != path {
+			t.Errorf("%q flattens to %q and expands to %q", path, flat, back)
+		}
+	}
+}
+
+func TestKeepLevels(t *testing.T) {
+	tests := []struct {
+		path    string
+		depth   int
+		keepTop bool
+		want    int
+	}{
+		{"a/b/c/d.jpg", 0, false, 0},
+		{"a/b/c/d.jpg", 1, false, 2},
+		{"a/b/c/d.jpg", 3, false, 0},
+		{"a/b/c/d.jpg", 0, true, 1},
+		{"a/b/c/d.jpg", 1, true, 2},
+		{"d.jpg", 0, true, 1},
+	}
+	for _, test := range tests {
+		if got := keepLevels(filepath.FromSlash(test.path), test.depth, test.keepTop); got != test.want {
+			t.Errorf("keepLevels(%q, %d, %v) = %d, want %d", test.path, test.depth, test.keepTop, got, test.want)
+		}
+	}
+}
+
+// flattenCase is a path with the scheme and levels it is flattened with.
+type flattenCase struct {
+	Path    string
+	Scheme  Scheme
+	Depth   int
+	KeepTop bool
+}
+
+// Generate builds paths from the characters of the schemes, dots and tags, so
+// that escapes, delimiters and extensions run into each other.
+func (flattenCase) Generate(rand *rand.Rand, size int) reflect.Value {
+	escapes := []string{"#", "@", "~", "é"}
+	fills := []string{"-", "_", "+", "=", "", "ab"}
+	c := flattenCase{Depth: rand.Intn(4), KeepTop: rand.Intn(2) == 0}
+	escape := escapes[rand.Intn(len(escapes))]
+	c.Scheme = Scheme{
+		Delimiter: fills[rand.Intn(len(fills))] + escape + fills[rand.Intn(len(fills))],
+		Escape:    escape,
+	}
+	if c.Scheme.Delimiter == escape {
+		c.Scheme.Delimiter += "-"
+	}
+	pieces := []string{"a", "b", ".", ".jpg", tag, escape, escape, c.Scheme.Delimiter, "-", "_"}
+	parts := make([]string, 1+rand.Intn(5))
+	for i := range parts {
+		for parts[i] == "" || parts[i] == "." || parts[i] == ".." {
+			parts[i] = ""
+			for n := 1 + rand.Intn(1+size/10); n > 0; n-- {
+				parts[i] += pieces[rand.Intn(len(pieces))]
+			}
+		}
+	}
+	c.Path = filepath.Join(parts...)
+	return reflect.ValueOf(c)
+}
+
+func TestRoundTripProperty(t *testing.T) {
+	roundTrip := func(c flattenCase) bool {
+		if c.Scheme.Validate() != nil {
+			return true
+		}
+		flat, changed := c.Scheme.flattenPath(c.Path, keepLevels(c.Path, c.Depth, c.KeepTop))
+		if !changed {
+			// only names at their final level which carry the tag are kept
+			_, tagged := untag(filepath.Base(c.Path))
+			return tagged
+		}
+		back, changed := c.Scheme.expandPath(flat)
+		if !changed || back != c.Path {
+			t.Logf("%q with %+v flattens to %q and expands to %q", c.Path, c.Scheme, flat, back)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 20000}); err != nil {
+		t.Fatal(err)
+	}
+}
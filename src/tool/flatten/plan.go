@@ -0,0 +1,173 @@
+package flatten
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/fileutil"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	opFlatten = "flatten"
+	opExpand  = "expand"
+)
+
+// Move renames a file inside the directory of a plan, both paths are relative to it.
+type Move struct {
+	From string
+	To   string
+}
+
+func (m Move) inverse() Move {
+	return Move{From: m.To, To: m.From}
+}
+
+// Plan holds every move of a flatten or expand, computed and checked before
+// any file is touched.
+type Plan struct {
+	Dir   string
+	Moves []Move
+	// Workers make the moves in parallel, Progress is called after each one.
+	Workers  int
+	Progress func(m Move, err error)
+	op       string
+	// journal is every move of the operation when the plan resumes or reverts
+	// one, nil for a new operation.
+	journal []Move
+	revert  bool
+	scheme  Scheme
+	dirs    sync.Map
+	// entries are the names in the archive of a plan renaming the entries of
+	// a zip, whose Dir is then the archive.
+	entries map[string]bool
+	mapping []Move
+}
+
+func (p *Plan) exists(rel string) bool {
+	if p.entries != nil {
+		return p.entries[rel]
+	}
+	return exists(filepath.Join(p.Dir, rel))
+}
+
+// check reports the moves sharing a target, the targets taken by other files,
+// and the moves which would not expand back to their origin. A target which
+// is moved away itself is taken too, as the moves run in any order.
+func (p *Plan) check(inverse func(string) (string, bool)) error {
+	var err error
+	targets := make(map[string]string, len(p.Moves))
+	for _, m := range p.Moves {
+		if other, ok := targets[m.To]; ok {
+			err = multierror.Append(err, fmt.Errorf("%w, %s and %s both move to %s", myerrors.ErrRenameConflict, other, m.From, m.To))
+			continue
+		}
+		targets[m.To] = m.From
+		if p.exists(m.To) {
+			err = multierror.Append(err, fmt.Errorf("%w, %s moves to existing %s", myerrors.ErrRenameConflict, m.From, m.To))
+			continue
+		}
+		if inverse != nil {
+			if back, _ := inverse(m.To); back != m.From {
+				err = multierror.Append(err, fmt.Errorf("%w, %s moves to %s which reads back as %s", myerrors.ErrAmbiguousPath, m.From, m.To, back))
+			}
+		}
+	}
+	return err
+}
+
+// Apply makes the moves. A new operation is written to the journal first and
+// the journal is only removed once every move succeeded, so that an
+// interrupted one can be resumed or reverted. A zip is rewritten at once
+// instead.
+func (p *Plan) Apply() (err error) {
+	if p.entries != nil {
+		return p.rewriteZip()
+	}
+	if p.journal == nil {
+		if len(p.Moves) == 0 {
+			return nil
+		}
+		if p.op == opFlatten {
+			if err := writeScheme(p.Dir, p.scheme); err != nil {
+				return err
+			}
+			if err := appendMapping(p.Dir, p.Moves); err != nil {
+				return err
+			}
+		}
+		if err := writeJournal(p.Dir, p.op, p.Moves); err != nil {
+			return err
+		}
+		p.journal = p.Moves
+	}
+	var mutex sync.Mutex
+	concurrent.ForEach(p.Moves, func(m Move) {
+		slog.Debug("moving", "path", filepath.Join(p.Dir, m.From), "to", filepath.Join(p.Dir, m.To))
+		er := p.move(m)
+		if p.Progress != nil {
+			p.Progress(m, er)
+		}
+		if er != nil {
+			mutex.Lock()
+			err = multierror.Append(err, er)
+			mutex.Unlock()
+		}
+	}, max(1, p.Workers))
+	if err != nil {
+		slog.Warn("journal kept, resume or revert", "path", filepath.Join(p.Dir, journalName))
+		return err
+	}
+	return p.finish()
+}
+
+func (p *Plan) finish() error {
+	moves := p.journal
+	if p.revert {
+		moves = make([]Move, len(p.journal))
+		for i, m := range p.journal {
+			moves[i] = m.inverse()
+		}
+	}
+	if (p.op == opExpand) != p.revert {
+		if err := dropMapping(p.Dir, moves); err != nil {
+			return err
+		}
+		if err := removeScheme(p.Dir); err != nil {
+			return err
+		}
+	} else {
+		dirs := make(map[string]bool)
+		for _, m := range moves {
+			dirs[filepath.Dir(filepath.Join(p.Dir, m.From))] = true
+		}
+		for dir := range dirs {
+			fileutil.RemoveEmptyDirs(dir, p.Dir)
+		}
+	}
+	return os.Remove(filepath.Join(p.Dir, journalName))
+}
+
+// createdDir makes a directory once for all the moves into it.
+type createdDir struct {
+	once sync.Once
+	err  error
+}
+
+func (p *Plan) move(m Move) error {
+	target := filepath.Join(p.Dir, m.To)
+	value, _ := p.dirs.LoadOrStore(filepath.Dir(target), new(createdDir))
+	dir := value.(*createdDir)
+	dir.once.Do(func() {
+		dir.err = os.MkdirAll(filepath.Dir(target), 0777)
+	})
+	if dir.err != nil {
+		return dir.err
+	}
+	return fileutil.Rename(filepath.Join(p.Dir, m.From), target)
+}
@@ -0,0 +1,101 @@
+package flatten
+
+import (
+	"ImageZipResize/myerrors"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestApplyParallel(t *testing.T) {
+	dir := t.TempDir()
+	paths := make([]string, 0)
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 16; j++ {
+			paths = append(paths, fmt.Sprintf("d%d/e%d/%02d.jpg", i%2, i, j))
+		}
+	}
+	writeTree(t, dir, paths...)
+	plan, err := PlanFlatten(dir, Options{Scheme: DefaultScheme})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	// the expand moves many files into each new directory at once
+	plan, err = PlanExpand(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mutex sync.Mutex
+	seen := make(map[Move]int)
+	plan.Workers = 8
+	plan.Progress = func(m Move, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		mutex.Lock()
+		seen[m]++
+		mutex.Unlock()
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, true, paths...)
+	if len(seen) != len(paths) {
+		t.Fatalf("progress of %d moves, want %d", len(seen), len(paths))
+	}
+	for m, n := range seen {
+		if n != 1 {
+			t.Errorf("progress of %v called %d times", m, n)
+		}
+	}
+}
+
+func TestApplyKeepsJournalOnCollision(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{"a/1.jpg", "a/2.jpg", "b/3.jpg", "b/4.jpg"}
+	writeTree(t, dir, paths...)
+	plan, err := PlanFlatten(dir, Options{Scheme: DefaultScheme})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan.Workers = 4
+	// a file takes a target after the plan is checked
+	var blocked Move
+	for _, m := range plan.Moves {
+		if m.From == "b/3.jpg" {
+			blocked = m
+		}
+	}
+	writeTree(t, dir, blocked.To)
+	err = plan.Apply()
+	if !errors.Is(err, myerrors.ErrRenameConflict) {
+		t.Fatalf("Apply = %v, want a rename conflict", err)
+	}
+	if !exists(filepath.Join(dir, journalName)) || !exists(filepath.Join(dir, "b/3.jpg")) {
+		t.Fatal("journal or the blocked file is gone")
+	}
+	if exists(filepath.Join(dir, "a/1.jpg")) || exists(filepath.Join(dir, "b/4.jpg")) {
+		t.Fatal("the other moves did not run")
+	}
+	// once the target is free the resume finishes the flatten
+	if err := os.Remove(filepath.Join(dir, blocked.To)); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = PlanResume(dir)
+	if err != nil || len(plan.Moves) != 1 || plan.Moves[0] != blocked {
+		t.Fatalf("PlanResume = %+v, %v, want the blocked move", plan, err)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Expand(dir); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, true, paths...)
+}
@@ -0,0 +1,107 @@
+package flatten
+
+import (
+	"ImageZipResize/myerrors"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// schemeName is the marker at the top of a flattened directory recording the
+// scheme its names are encoded with, so that they can be decoded without
+// the mapping.
+const schemeName = ".flatten.scheme.json"
+
+// Scheme joins the folded directories of a name with Delimiter and doubles
+// Escape, a single character which appears once in Delimiter, where it
+// occurs in them.
+type Scheme struct {
+	Delimiter string `json:"delimiter"`
+	Escape    string `json:"escape"`
+}
+
+var DefaultScheme = Scheme{Delimiter: delimiter, Escape: escape}
+
+func (s Scheme) Validate() error {
+	switch {
+	case utf8.RuneCountInString(s.Escape) != 1:
+		return fmt.Errorf("escape %q is not a single character", s.Escape)
+	case strings.Count(s.Delimiter, s.Escape) != 1, s.Delimiter == s.Escape:
+		return fmt.Errorf("delimiter %q must contain the escape %q once and another character", s.Delimiter, s.Escape)
+	case strings.ContainsAny(s.Delimiter, "./\\"):
+		return fmt.Errorf("delimiter %q must not contain dots or separators", s.Delimiter)
+	}
+	return nil
+}
+
+// readScheme returns the scheme of the marker, or the default one without marker.
+func readScheme(dir string) (Scheme, bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, schemeName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return DefaultScheme, false, nil
+	}
+	if err != nil {
+		return DefaultScheme, false, err
+	}
+	s, err := decodeScheme(data)
+	if err != nil {
+		return DefaultScheme, false, fmt.Errorf("scheme %s, %w", filepath.Join(dir, schemeName), err)
+	}
+	return s, true, nil
+}
+
+func decodeScheme(data []byte) (Scheme, error) {
+	var s Scheme
+	if err := json.Unmarshal(data, &s); err != nil {
+		return DefaultScheme, err
+	}
+	if err := s.Validate(); err != nil {
+		return DefaultScheme, err
+	}
+	return s, nil
+}
+
+// checkScheme refuses to flatten with another scheme than the one the
+// directory is already flattened with.
+func checkScheme(dir string, s Scheme) error {
+	recorded, ok, err := readScheme(dir)
+	if err != nil {
+		return err
+	}
+	return s.check(dir, recorded, ok)
+}
+
+func (s Scheme) check(path string, recorded Scheme, ok bool) error {
+	if !ok || recorded == s {
+		return nil
+	}
+	return fmt.Errorf("%w, %s is flattened with delimiter %q and escape %q", myerrors.ErrAmbiguousPath, path, recorded.Delimiter, recorded.Escape)
+}
+
+func writeScheme(dir string, s Scheme) error {
+	if _, ok, err := readScheme(dir); err != nil || ok {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, schemeName), append(data, '\n'), 0666)
+}
+
+// removeScheme drops the marker once the mapping is gone.
+func removeScheme(dir string) error {
+	if exists(filepath.Join(dir, mappingName)) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(dir, schemeName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
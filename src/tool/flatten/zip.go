@@ -0,0 +1,251 @@
+package flatten
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PlanFlattenZip plans renaming the entries of a zip like Flatten moves the
+// files of a directory. The mapping and the scheme are kept as entries of the
+// zip, directory entries are dropped.
+func PlanFlattenZip(path string, options Options) (*Plan, error) {
+	if err := options.Scheme.Validate(); err != nil {
+		return nil, err
+	}
+	plan, reader, err := openZipPlan(path, opFlatten)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if err := options.Scheme.check(path, plan.scheme, plan.scheme != Scheme{}); err != nil {
+		return nil, err
+	}
+	plan.scheme = options.Scheme
+	flattened := make(map[string]bool, len(plan.mapping))
+	for _, m := range plan.mapping {
+		flattened[m.From] = true
+	}
+	for _, file := range reader.File {
+		rel := filepath.FromSlash(file.Name)
+		if isZipDir(file) || isControlFile(rel) || flattened[rel] {
+			continue
+		}
+		newRel, changed := options.Scheme.flattenPath(rel, keepLevels(rel, options.Depth, options.KeepTop))
+		if !changed {
+			slog.Debug("not changed", "path", path, "entry", file.Name)
+			continue
+		}
+		plan.Moves = append(plan.Moves, Move{From: rel, To: newRel})
+	}
+	return plan, plan.check(options.Scheme.expandPath)
+}
+
+// PlanExpandZip plans renaming the flattened entries of a zip back to their
+// original names, by its mapping entry when it has one.
+func PlanExpandZip(path string) (*Plan, error) {
+	plan, reader, err := openZipPlan(path, opExpand)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if plan.scheme == (Scheme{}) {
+		plan.scheme = DefaultScheme
+	}
+	scheme := plan.scheme
+	if plan.mapping != nil {
+		for _, m := range plan.mapping {
+			if plan.entries[m.From] {
+				plan.Moves = append(plan.Moves, m)
+			}
+		}
+		return plan, plan.check(nil)
+	}
+	for _, file := range reader.File {
+		rel := filepath.FromSlash(file.Name)
+		if isZipDir(file) || isControlFile(rel) {
+			continue
+		}
+		if newRel, changed := scheme.expandPath(rel); changed {
+			plan.Moves = append(plan.Moves, Move{From: rel, To: newRel})
+		}
+	}
+	return plan, plan.check(nil)
+}
+
+// openZipPlan reads the entry names of the zip with its mapping and scheme,
+// the scheme is left empty without a scheme entry.
+func openZipPlan(path string, op string) (*Plan, *zip.ReadCloser, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	plan := &Plan{Dir: path, op: op, entries: make(map[string]bool, len(reader.File))}
+	for _, file := range reader.File {
+		rel := filepath.FromSlash(file.Name)
+		plan.entries[rel] = true
+		switch rel {
+		case mappingName:
+			plan.mapping, err = readZipEntry(file, decodeMapping)
+		case schemeName:
+			plan.scheme, err = readZipEntry(file, func(r io.Reader) (Scheme, error) {
+				data, err := io.ReadAll(r)
+				if err != nil {
+					return Scheme{}, err
+				}
+				return decodeScheme(data)
+			})
+		}
+		if err != nil {
+			reader.Close()
+			return nil, nil, err
+		}
+	}
+	return plan, reader, nil
+}
+
+func readZipEntry[T any](file *zip.File, decode func(io.Reader) (T, error)) (T, error) {
+	r, err := file.Open()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer r.Close()
+	return decode(r)
+}
+
+func isZipDir(file *zip.File) bool {
+	return strings.HasSuffix(file.Name, "/")
+}
+
+// rewriteZip copies the entries raw under their new names into a temporary
+// zip, so that nothing is recompressed, and replaces the zip by it.
+func (p *Plan) rewriteZip() error {
+	if len(p.Moves) == 0 {
+		return nil
+	}
+	reader, err := zip.OpenReader(p.Dir)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	renames := make(map[string]string, len(p.Moves))
+	for _, m := range p.Moves {
+		renames[m.From] = m.To
+	}
+	mapping := p.mapping
+	if p.op == opFlatten {
+		for _, m := range p.Moves {
+			mapping = append(mapping, m.inverse())
+		}
+	} else {
+		left := make([]Move, 0, len(mapping))
+		for _, m := range mapping {
+			if renames[m.From] != m.To {
+				left = append(left, m)
+			}
+		}
+		mapping = left
+	}
+
+	stat, err := os.Stat(p.Dir)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p.Dir), filepath.Base(p.Dir)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(stat.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	w := zip.NewWriter(tmp)
+	if err := w.SetComment(reader.Comment); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := p.copyZipEntries(w, reader, renames); err != nil {
+		tmp.Close()
+		return err
+	}
+	if len(mapping) > 0 {
+		err = p.addZipControls(w, mapping)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if er := tmp.Close(); err == nil {
+		err = er
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("rewritten", "path", p.Dir, "renamed", len(p.Moves))
+	return os.Rename(tmp.Name(), p.Dir)
+}
+
+func (p *Plan) copyZipEntries(w *zip.Writer, reader *zip.ReadCloser, renames map[string]string) error {
+	for _, file := range reader.File {
+		rel := filepath.FromSlash(file.Name)
+		if isControlFile(rel) || (isZipDir(file) && p.op == opFlatten) {
+			continue
+		}
+		header := file.FileHeader
+		to, renamed := renames[rel]
+		if renamed {
+			header.Name = filepath.ToSlash(to)
+		}
+		raw, err := file.OpenRaw()
+		if err == nil {
+			var dst io.Writer
+			if dst, err = w.CreateRaw(&header); err == nil {
+				_, err = io.Copy(dst, raw)
+			}
+		}
+		if renamed && p.Progress != nil {
+			p.Progress(Move{From: rel, To: to}, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addZipControls writes the mapping, given as expanding moves, and the scheme.
+func (p *Plan) addZipControls(w *zip.Writer, mapping []Move) error {
+	flattening := make([]Move, len(mapping))
+	for i, m := range mapping {
+		flattening[i] = m.inverse()
+	}
+	var buffer bytes.Buffer
+	if err := encodeMapping(&buffer, flattening); err != nil {
+		return err
+	}
+	now := time.Now()
+	dst, err := w.CreateHeader(&zip.FileHeader{Name: mappingName, Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+	if _, err := dst.Write(buffer.Bytes()); err != nil {
+		return err
+	}
+	data, err := json.Marshal(p.scheme)
+	if err != nil {
+		return err
+	}
+	dst, err = w.CreateHeader(&zip.FileHeader{Name: schemeName, Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(append(data, '\n'))
+	return err
+}
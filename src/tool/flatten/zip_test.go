@@ -0,0 +1,128 @@
+package flatten
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeZip writes a zip of entries holding their own name, names ending with
+// a slash are directories.
+func writeZip(t *testing.T, path string, names ...string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(file)
+	for _, name := range names {
+		dst, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			dst.Write([]byte(name))
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readZip returns the content of the entries of a zip by their name.
+func readZip(t *testing.T, path string) map[string]string {
+	t.Helper()
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	entries := make(map[string]string, len(reader.File))
+	for _, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[file.Name] = string(data)
+	}
+	return entries
+}
+
+func zipNames(entries map[string]string) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func applyZip(t *testing.T, plan *Plan, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlattenExpandZip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.cbz")
+	writeZip(t, path, "a/", "a/b/", "a/b/001.jpg", "a/README", "top.jpg")
+
+	plan, err := PlanFlattenZip(path, Options{Scheme: DefaultScheme})
+	applyZip(t, plan, err)
+	entries := readZip(t, path)
+	want := []string{mappingName, schemeName, "a-#-README.flatten", "a-#-b-#-001.flatten.jpg", "top.flatten.jpg"}
+	sort.Strings(want)
+	if got := zipNames(entries); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("entries = %v, want %v", got, want)
+	}
+	if entries["a-#-b-#-001.flatten.jpg"] != "a/b/001.jpg" {
+		t.Errorf("content moved, got %q", entries["a-#-b-#-001.flatten.jpg"])
+	}
+
+	plan, err = PlanExpandZip(path)
+	applyZip(t, plan, err)
+	entries = readZip(t, path)
+	for name, content := range entries {
+		if name != content {
+			t.Errorf("%s holds %s", name, content)
+		}
+	}
+	if len(entries) != 3 {
+		t.Errorf("entries = %v, want the 3 files without the mapping", zipNames(entries))
+	}
+}
+
+func TestExpandZipWithoutMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.zip")
+	writeZip(t, path, "a-#-001.flatten.jpg", "a##-#-README.flatten", "plain.jpg")
+	plan, err := PlanExpandZip(path)
+	applyZip(t, plan, err)
+	got := zipNames(readZip(t, path))
+	if want := []string{"a#/README", "a/001.jpg", "plain.jpg"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("entries = %v, want %v", got, want)
+	}
+}
+
+func TestFlattenZipConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.zip")
+	writeZip(t, path, "a/b.jpg", "a-#-b.flatten.jpg")
+	if _, err := PlanFlattenZip(path, Options{Scheme: DefaultScheme}); err == nil {
+		t.Fatal("PlanFlattenZip() of a taken name succeeded")
+	}
+}
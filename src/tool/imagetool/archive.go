@@ -0,0 +1,206 @@
+package imagetool
+
+import (
+	"ImageZipResize/myerrors"
+	"archive/zip"
+	"errors"
+	"image"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+)
+
+const (
+	extCBZ = ".cbz"
+	extCBR = ".cbr"
+	extCB7 = ".cb7"
+	extRAR = ".rar"
+	ext7Z  = ".7z"
+)
+
+var supportedArchiveExt = map[string]bool{
+	extZip: true,
+	extCBZ: true,
+	extCBR: true,
+	extCB7: true,
+	extRAR: true,
+	ext7Z:  true,
+}
+
+func IsSupportedArchiveFilename(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return supportedArchiveExt[ext]
+}
+
+// archiveOutputExt is the extension of the zip written for an archive,
+// comic book archives stay comic book archives.
+func archiveOutputExt(filename string) string {
+	if strings.HasPrefix(strings.ToLower(filepath.Ext(filename)), ".cb") {
+		return extCBZ
+	}
+	return extZip
+}
+
+// ArchiveEntry is a file or a directory of an archive.
+type ArchiveEntry struct {
+	Name     string
+	Modified time.Time
+	IsDir    bool
+	// Zip is the entry of a zip archive, which can be copied without
+	// recompressing, nil for the other archives.
+	Zip  *zip.File
+	open func() (io.ReadCloser, error)
+}
+
+// Open reads the content of the entry, it is only valid until the next entry
+// is read from the archive.
+func (e ArchiveEntry) Open() (io.ReadCloser, error) {
+	return e.open()
+}
+
+// ArchiveReader reads the entries of an archive in their stored order, solid
+// archives can only be decompressed in that order.
+type ArchiveReader interface {
+	// Next returns the next entry, io.EOF after the last one.
+	Next() (ArchiveEntry, error)
+	Close() error
+}
+
+// OpenArchive opens a zip, cbz, rar, cbr, 7z or cb7 archive by its extension.
+func OpenArchive(filename string) (ArchiveReader, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case extRAR, extCBR:
+		reader, err := rardecode.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		return &rarArchive{reader: reader}, nil
+	case ext7Z, extCB7:
+		reader, err := sevenzip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		return &sevenZipArchive{reader: reader}, nil
+	}
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &zipArchive{reader: reader}, nil
+}
+
+type zipArchive struct {
+	reader *zip.ReadCloser
+	next   int
+}
+
+func (a *zipArchive) Next() (ArchiveEntry, error) {
+	if a.next >= len(a.reader.File) {
+		return ArchiveEntry{}, io.EOF
+	}
+	file := a.reader.File[a.next]
+	a.next++
+	return ArchiveEntry{
+		Name:     file.Name,
+		Modified: file.Modified,
+		IsDir:    file.FileInfo().IsDir(),
+		Zip:      file,
+		open:     file.Open,
+	}, nil
+}
+
+func (a *zipArchive) Close() error {
+	return a.reader.Close()
+}
+
+type rarArchive struct {
+	reader *rardecode.ReadCloser
+}
+
+func (a *rarArchive) Next() (ArchiveEntry, error) {
+	header, err := a.reader.Next()
+	if err != nil {
+		return ArchiveEntry{}, err
+	}
+	return ArchiveEntry{
+		Name:     header.Name,
+		Modified: header.ModificationTime,
+		IsDir:    header.IsDir,
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(a.reader), nil
+		},
+	}, nil
+}
+
+func (a *rarArchive) Close() error {
+	return a.reader.Close()
+}
+
+type sevenZipArchive struct {
+	reader *sevenzip.ReadCloser
+	next   int
+}
+
+func (a *sevenZipArchive) Next() (ArchiveEntry, error) {
+	if a.next >= len(a.reader.File) {
+		return ArchiveEntry{}, io.EOF
+	}
+	file := a.reader.File[a.next]
+	a.next++
+	return ArchiveEntry{
+		Name:     file.Name,
+		Modified: file.Modified,
+		IsDir:    file.FileInfo().IsDir(),
+		open:     file.Open,
+	}, nil
+}
+
+func (a *sevenZipArchive) Close() error {
+	return a.reader.Close()
+}
+
+// inspectArchive counts the images of an archive and reads the size of the
+// largest, images which cannot be decoded are left to magick.
+func inspectArchive(filename string) (info ImageInfo, err error) {
+	reader, err := OpenArchive(filename)
+	if err != nil {
+		return info, err
+	}
+	defer reader.Close()
+	info = ImageInfo{Format: strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), "."), Frames: 1}
+	for {
+		entry, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return info, err
+		}
+		if entry.IsDir || !IsSupportedImageFilename(entry.Name) {
+			continue
+		}
+		info.Images++
+		conf, err := entryConfig(entry)
+		if err == nil && int64(conf.Width)*int64(conf.Height) > int64(info.Width)*int64(info.Height) {
+			info.Width, info.Height = conf.Width, conf.Height
+		}
+	}
+	if info.Images == 0 {
+		return info, myerrors.ErrNoArchiveImages
+	}
+	return info, nil
+}
+
+func entryConfig(entry ArchiveEntry) (image.Config, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer reader.Close()
+	conf, _, err := image.DecodeConfig(reader)
+	return conf, err
+}
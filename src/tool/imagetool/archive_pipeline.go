@@ -0,0 +1,227 @@
+package imagetool
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/system"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// archiveJob is an entry on its way from the reader to the writer, images are
+// resized by the workers meanwhile.
+type archiveJob struct {
+	entry   ArchiveEntry
+	isImage bool
+	newExt  string
+	// data is the content of an image, or of an entry which cannot be read
+	// again once the reader moved on.
+	data    []byte
+	mem     system.ByteSize
+	weight  int64
+	resized []byte
+	err     error
+	done    chan struct{}
+}
+
+// archiveMagick limits the magick processes of all the archives resized at the
+// same time to the parallelism, each archive would start as many otherwise.
+var archiveMagick = concurrent.NewLimiter(math.MaxInt64, 1)
+
+// resizeArchiveEntries resizes the images of an archive in parallel and writes
+// every entry in its order once it is done. The jobs between the writer and the
+// reader hold their memory from the budget, so the reader waits for the writer
+// instead of loading the whole archive.
+func resizeArchiveEntries(logger *slog.Logger, src ArchiveReader, dst *zip.Writer, to image.Point, mode Mode, mem system.ByteSize, tmp string) (int, error) {
+	workers := max(1, int(system.GetParallelism()))
+	limiter := concurrent.NewLimiter(int64(mem), 2*workers)
+	archiveMagick.SetLimit(math.MaxInt64, workers)
+	work := make(chan *archiveJob)
+	ordered := make(chan *archiveJob, 2*workers)
+	failed := new(atomic.Bool)
+
+	wg := new(sync.WaitGroup)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range work {
+				if !failed.Load() {
+					archiveMagick.Acquire(1)
+					job.resized, job.err = resizeMagickData(logger, job.entry.Name, job.data, path.Ext(job.entry.Name), job.newExt, to, mode, job.mem, tmp)
+					archiveMagick.Release(1)
+				}
+				close(job.done)
+			}
+		}()
+	}
+	written := make(chan error, 1)
+	go func() {
+		written <- writeArchiveJobs(logger, dst, ordered, limiter, failed)
+	}()
+
+	images, err := readArchiveJobs(src, work, ordered, limiter, mem, failed)
+	if err != nil {
+		failed.Store(true)
+	}
+	close(work)
+	close(ordered)
+	wg.Wait()
+	if writeErr := <-written; err == nil {
+		err = writeErr
+	}
+	return images, err
+}
+
+func readArchiveJobs(src ArchiveReader, work, ordered chan<- *archiveJob, limiter *concurrent.Limiter, mem system.ByteSize, failed *atomic.Bool) (int, error) {
+	images := 0
+	for !failed.Load() {
+		entry, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			return images, nil
+		}
+		if err != nil {
+			return images, err
+		}
+		job := &archiveJob{entry: entry, done: make(chan struct{})}
+		job.isImage = !entry.IsDir && IsSupportedImageFilename(entry.Name)
+		if job.isImage || (!entry.IsDir && entry.Zip == nil) {
+			if job.data, err = readEntryData(entry); err != nil {
+				return images, fmt.Errorf("entry %s, %w", entry.Name, err)
+			}
+		}
+		job.weight = int64(len(job.data))
+		if job.isImage {
+			job.newExt = extWEBP
+			if images == 0 {
+				job.newExt = path.Ext(entry.Name)
+			}
+			images++
+			job.mem = min(estimateDataMemory(job.data), mem)
+			job.weight += int64(job.mem)
+		}
+		limiter.Acquire(max(1, job.weight))
+		ordered <- job
+		if job.isImage {
+			work <- job
+		} else {
+			close(job.done)
+		}
+	}
+	return images, nil
+}
+
+// writeArchiveJobs writes the jobs in their order, after a failure it only
+// releases their memory until the pipeline is drained.
+func writeArchiveJobs(logger *slog.Logger, dst *zip.Writer, ordered <-chan *archiveJob, limiter *concurrent.Limiter, failed *atomic.Bool) error {
+	names := make(map[string]bool)
+	var err error
+	for job := range ordered {
+		<-job.done
+		if err == nil {
+			var name string
+			if name, err = writeArchiveJob(logger, dst, job, names); err != nil {
+				err = fmt.Errorf("entry %s, %w", job.entry.Name, err)
+				failed.Store(true)
+			}
+			names[name] = true
+		}
+		limiter.Release(max(1, job.weight))
+	}
+	return err
+}
+
+// writeArchiveJob writes the resized image when it is smaller, otherwise the
+// origin, under a name no earlier entry took, and returns that name.
+func writeArchiveJob(logger *slog.Logger, dst *zip.Writer, job *archiveJob, names map[string]bool) (string, error) {
+	entry := job.entry
+	if job.isImage {
+		var magickErr *myerrors.MagickError
+		if job.err != nil && (!errors.As(job.err, &magickErr) || myerrors.IsResourceExhausted(job.err)) {
+			return "", job.err
+		}
+		if job.err != nil {
+			logger.Warn("keep archive entry", "entry", entry.Name, "error", job.err)
+		}
+		if job.err == nil && len(job.resized) < len(job.data) {
+			name := freeEntryName(strings.TrimSuffix(entry.Name, path.Ext(entry.Name))+job.newExt, names)
+			return name, writeArchiveData(dst, &zip.FileHeader{Name: name, Modified: entry.Modified, Method: zip.Store}, job.resized)
+		}
+	}
+	name := entry.Name
+	if !entry.IsDir {
+		name = freeEntryName(name, names)
+	}
+	return name, copyArchiveEntry(dst, job, name)
+}
+
+// freeEntryName numbers a name taken by an earlier entry like name_2.ext,
+// as "001.jpg" and "001.webp" are both resized to "001.webp".
+func freeEntryName(name string, names map[string]bool) string {
+	ext := path.Ext(name)
+	free := name
+	for i := 2; names[free]; i++ {
+		free = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	return free
+}
+
+// copyArchiveEntry copies the entries of zip archives without recompressing,
+// the entries of the other archives are compressed again.
+func copyArchiveEntry(dst *zip.Writer, job *archiveJob, name string) error {
+	entry := job.entry
+	if entry.Zip != nil {
+		reader, err := entry.Zip.OpenRaw()
+		if err != nil {
+			return err
+		}
+		header := entry.Zip.FileHeader
+		header.Name = name
+		writer, err := dst.CreateRaw(&header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, reader)
+		return err
+	}
+	if entry.IsDir {
+		_, err := dst.CreateHeader(&zip.FileHeader{Name: strings.TrimSuffix(name, "/") + "/", Modified: entry.Modified, Method: zip.Store})
+		return err
+	}
+	return writeArchiveData(dst, &zip.FileHeader{Name: name, Modified: entry.Modified, Method: zip.Deflate}, job.data)
+}
+
+func writeArchiveData(dst *zip.Writer, header *zip.FileHeader, data []byte) error {
+	writer, err := dst.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+func readEntryData(entry ArchiveEntry) ([]byte, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// estimateDataMemory predicts the memory magick needs for an image in memory,
+// the frames of animated images are not counted.
+func estimateDataMemory(data []byte) system.ByteSize {
+	conf, _, _ := image.DecodeConfig(bytes.NewReader(data))
+	return ImageInfo{Width: conf.Width, Height: conf.Height, Frames: 1}.EstimateMemory()
+}
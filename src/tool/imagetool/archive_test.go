@@ -0,0 +1,261 @@
+package imagetool
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/util/system"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type zipEntry struct {
+	name string
+	data []byte
+}
+
+func writeTestZip(t *testing.T, path string, entries ...zipEntry) string {
+	t.Helper()
+	buffer := new(bytes.Buffer)
+	w := zip.NewWriter(buffer)
+	for _, e := range entries {
+		dst, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst.Write(e.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buffer.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	buffer := new(bytes.Buffer)
+	if err := png.Encode(buffer, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestInspectArchive(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestZip(t, filepath.Join(dir, "book.cbz"),
+		zipEntry{"001.png", testPNG(t, 20, 30)},
+		zipEntry{"sub/", nil},
+		zipEntry{"sub/002.png", testPNG(t, 40, 10)},
+		zipEntry{"info.txt", []byte("text")},
+	)
+	info, err := Inspect(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Images != 2 || info.Width != 20 || info.Height != 30 || info.Format != "cbz" {
+		t.Errorf("Inspect() = %+v, want 2 images up to 20x30", info)
+	}
+
+	empty := writeTestZip(t, filepath.Join(dir, "empty.zip"), zipEntry{"info.txt", []byte("text")})
+	if _, err := Inspect(empty); !errors.Is(err, myerrors.ErrNoArchiveImages) {
+		t.Errorf("Inspect() of an archive without images error = %v, want %v", err, myerrors.ErrNoArchiveImages)
+	}
+}
+
+func TestVerifyArchive(t *testing.T) {
+	dir := t.TempDir()
+	still := readTestdata(t, "yellow_rose.lossy-with-alpha.webp")
+	good := writeTestZip(t, filepath.Join(dir, "good.resized.cbz"),
+		zipEntry{"001.png", testPNG(t, 20, 30)},
+		zipEntry{"002.webp", animate(t, still, still)},
+		zipEntry{"info.txt", []byte("text")},
+	)
+	if err := Verify(good); err != nil {
+		t.Errorf("Verify() of a valid archive: %v", err)
+	}
+
+	truncated := testPNG(t, 20, 30)
+	broken := writeTestZip(t, filepath.Join(dir, "broken.resized.zip"),
+		zipEntry{"001.png", testPNG(t, 20, 30)},
+		zipEntry{"002.png", truncated[:len(truncated)-20]},
+	)
+	if err := Verify(broken); err == nil {
+		t.Error("Verify() of an archive with a truncated image succeeded")
+	}
+
+	empty := writeTestZip(t, filepath.Join(dir, "empty.resized.cbz"), zipEntry{"info.txt", []byte("text")})
+	if err := Verify(empty); !errors.Is(err, myerrors.ErrNoArchiveImages) {
+		t.Errorf("Verify() of an archive without images error = %v, want %v", err, myerrors.ErrNoArchiveImages)
+	}
+}
+
+// fakeMagick puts a magick on the path which answers after a random delay, so
+// that the entries finish out of order, with the output format and fails for
+// data containing FAIL.
+func fakeMagick(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake magick is a shell script")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+for last; do :; done
+data=$(cat)
+sleep "0.0$(od -An -N1 -tu1 /dev/urandom | tr -d ' ' | cut -c1)"
+case "$data" in *FAIL*) echo "bad image" >&2; exit 1 ;; esac
+printf '%s' "$last"
+`
+	if err := os.WriteFile(filepath.Join(dir, "magick"), []byte(script), 0777); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestResizeArchiveEntries(t *testing.T) {
+	fakeMagick(t)
+	dir := t.TempDir()
+	entries := []zipEntry{{"cover.jpg", []byte("a large cover image")}}
+	want := []zipEntry{{"cover.jpg", []byte("jpg:-")}}
+	for i := 1; i <= 40; i++ {
+		name := fmt.Sprintf("pages/%03d", i)
+		switch {
+		case i%10 == 0:
+			// a failing page is kept
+			entries = append(entries, zipEntry{name + ".png", []byte("FAIL to resize")})
+			want = append(want, zipEntry{name + ".png", []byte("FAIL to resize")})
+		case i%7 == 0:
+			// both images are resized to the same name
+			entries = append(entries, zipEntry{name + ".jpg", []byte("a large page image")}, zipEntry{name + ".webp", []byte("a large page image")})
+			want = append(want, zipEntry{name + ".webp", []byte("webp:-")}, zipEntry{name + "_2.webp", []byte("webp:-")})
+		default:
+			entries = append(entries, zipEntry{name + ".png", []byte("a large page image")})
+			want = append(want, zipEntry{name + ".webp", []byte("webp:-")})
+		}
+	}
+	// a resized name taken by a later entry which is copied
+	entries = append(entries, zipEntry{"pages/041.png", []byte("a large page image")}, zipEntry{"pages/041.webp", []byte("tiny")})
+	want = append(want, zipEntry{"pages/041.webp", []byte("webp:-")}, zipEntry{"pages/041_2.webp", []byte("tiny")})
+	entries = append(entries, zipEntry{"info.txt", []byte("text")})
+	want = append(want, zipEntry{"info.txt", []byte("text")})
+
+	src, err := OpenArchive(writeTestZip(t, filepath.Join(dir, "book.cbz"), entries...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	out := new(bytes.Buffer)
+	dst := zip.NewWriter(out)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	images, err := resizeArchiveEntries(logger, src, dst, image.Pt(100, 100), ModeContain.DoNotEnlarge(), 1<<30, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if images != len(entries)-1 {
+		t.Errorf("resized %d images, want %d", images, len(entries)-1)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.File) != len(want) {
+		t.Fatalf("%d entries written, want %d", len(reader.File), len(want))
+	}
+	for i, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Name != want[i].name || !bytes.Equal(data, want[i].data) {
+			t.Errorf("entry %d is %s holding %q, want %s holding %q", i, file.Name, data, want[i].name, want[i].data)
+		}
+	}
+}
+
+func TestResizeArchivesShareWorkers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake magick is a shell script")
+	}
+	dir := t.TempDir()
+	// the fake magick logs how many of them are running
+	running := filepath.Join(dir, "running")
+	if err := os.Mkdir(running, 0777); err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+for last; do :; done
+cat >/dev/null
+mark=$(mktemp "$RUNNING/XXXXXX")
+ls "$RUNNING" | wc -l >> "$RUNNING.log"
+sleep 0.05
+rm "$mark"
+printf '%s' "$last"
+`
+	if err := os.WriteFile(filepath.Join(dir, "magick"), []byte(script), 0777); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("RUNNING", running)
+	par := system.GetParallelism()
+	system.SetParallelism(2)
+	defer system.SetParallelism(par)
+
+	entries := make([]zipEntry, 0)
+	for i := 0; i < 6; i++ {
+		entries = append(entries, zipEntry{fmt.Sprintf("%02d.png", i), []byte("a large page image")})
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			src, err := OpenArchive(writeTestZip(t, filepath.Join(dir, fmt.Sprintf("book%d.cbz", i)), entries...))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer src.Close()
+			dst := zip.NewWriter(io.Discard)
+			if _, err := resizeArchiveEntries(logger, src, dst, image.Pt(100, 100), ModeContain.DoNotEnlarge(), 1<<30, dir); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	data, err := os.ReadFile(running + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := strings.Fields(string(data))
+	if len(counts) != 3*len(entries) {
+		t.Fatalf("magick ran %d times, want %d", len(counts), 3*len(entries))
+	}
+	for _, count := range counts {
+		if n, _ := strconv.Atoi(count); n > 2 {
+			t.Fatalf("%d magick processes of the archives at once, want at most 2", n)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package imagetool
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/util/fileutil"
+	"ImageZipResize/util/filters"
+	"ImageZipResize/util/slices"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const legacyBackupExt = ".backup"
+
+var backupLock sync.Mutex
+var versionPattern = regexp.MustCompile(`^(.*)\.~(\d+)~(\.[^./\\]*)?$`)
+
+// Backup is an original file kept by a BackupStore.
+type Backup struct {
+	// Origin is the path the original file was moved from.
+	Origin string
+	// Location is the path of the backup file, or the entry name inside Archive.
+	Location string
+	// Archive is the archive holding the backup, empty for plain files.
+	Archive string
+	// Version counts the backups of the same origin, starting at 1.
+	Version int
+	ModTime time.Time
+	Size    int64
+}
+
+// BackupStore keeps the originals replaced by resized images.
+type BackupStore interface {
+	// Backup moves file, which lies under base, into the store. done, if not
+	// nil, runs once the backup is durably in the store, which may be after
+	// Backup returned, and is where the backup gets recorded.
+	Backup(base, file string, done func(Backup) error) (Backup, error)
+	// List returns the backups of the files under path, path may also point
+	// into the store itself.
+	List(path string) ([]Backup, error)
+	Open(b Backup) (io.ReadCloser, error)
+	// Restore moves a backup back to its origin, an existing file is never replaced.
+	Restore(b Backup) error
+	// Remove deletes a backup for good.
+	Remove(b Backup) error
+	// Flush finishes the pending work of the store, which stays usable.
+	Flush() error
+	// Close finishes the pending work of the store.
+	Close() error
+}
+
+// NewBackupStore creates the store of the kind: tree keeps backups in
+// .resize.backup beside the files, mirror keeps them under root mirroring the
+// absolute paths, zip and tar keep them in one archive per base.
+func NewBackupStore(kind string, root string) (BackupStore, error) {
+	switch kind {
+	case "", "tree":
+		return treeStore{}, nil
+	case "mirror":
+		if root == "" {
+			return nil, errors.New("mirror backup store needs a backup root")
+		}
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		return &mirrorStore{root: abs}, nil
+	case "zip", "tar":
+		return newArchiveStore(kind), nil
+	}
+	return nil, fmt.Errorf("unknown backup store %q", kind)
+}
+
+// versionedName names the n-th backup of the same file, the first keeps the name.
+func versionedName(name string, version int) string {
+	if version <= 1 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s.~%d~%s", strings.TrimSuffix(name, ext), version, ext)
+}
+
+// parseVersionedName is the inverse of versionedName, it also accepts the
+// name.backup form once used for the second backup.
+func parseVersionedName(name string) (string, int) {
+	if strings.HasSuffix(name, legacyBackupExt) {
+		return strings.TrimSuffix(name, legacyBackupExt), 2
+	}
+	m := versionPattern.FindStringSubmatch(name)
+	if m == nil {
+		return name, 1
+	}
+	version, err := strconv.Atoi(m[2])
+	if err != nil || version < 2 {
+		return name, 1
+	}
+	return m[1] + m[3], version
+}
+
+// nextBackupPath returns the first unused versioned path of a backup file.
+func nextBackupPath(path string) (string, int, error) {
+	for version := 1; ; version++ {
+		to := versionedName(path, version)
+		exist, err := isFileExist(to)
+		if err != nil {
+			return "", 0, err
+		}
+		if !exist && version == 2 {
+			exist, err = isFileExist(path + legacyBackupExt)
+			if err != nil {
+				return "", 0, err
+			}
+		}
+		if !exist {
+			return to, version, nil
+		}
+	}
+}
+
+// moveToBackup moves file to the next free version of the backup path.
+func moveToBackup(file, path string) (Backup, error) {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return Backup{}, err
+	}
+	backupLock.Lock()
+	defer backupLock.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return Backup{}, err
+	}
+	to, version, err := nextBackupPath(path)
+	if err != nil {
+		return Backup{}, err
+	}
+	if err := fileutil.Move(file, to); err != nil {
+		if errors.Is(err, myerrors.ErrRenameConflict) {
+			return Backup{}, fmt.Errorf("%w, %s", myerrors.ErrBackupConflict, to)
+		}
+		return Backup{}, err
+	}
+	return Backup{Origin: file, Location: to, Version: version, ModTime: stat.ModTime(), Size: stat.Size()}, nil
+}
+
+// MoveDuplicate moves file, which lies under base, into the .resize.dedupe
+// directory of base, apart from the backup store and its manifest, and
+// returns its new path.
+func MoveDuplicate(base, file string) (string, error) {
+	rel, err := filepath.Rel(base, file)
+	if err != nil {
+		return "", err
+	}
+	b, err := moveToBackup(file, filepath.Join(filepath.Clean(base), dedupeDir, rel))
+	return b.Location, err
+}
+
+// walkBackups lists the regular files under dir, origin maps each of them
+// back to its original path and skips a file by returning false.
+func walkBackups(dir string, origin func(path string) (string, bool)) ([]Backup, error) {
+	backups := make([]Backup, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		from, ok := origin(path)
+		if !ok {
+			return nil
+		}
+		from, version := parseVersionedName(from)
+		backups = append(backups, Backup{Origin: from, Location: path, Version: version, ModTime: info.ModTime(), Size: info.Size()})
+		return nil
+	})
+	return backups, err
+}
+
+// isWithin reports whether path is dir or lies under it.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func openBackupFile(b Backup) (io.ReadCloser, error) {
+	return os.Open(b.Location)
+}
+
+func restoreBackupFile(b Backup) error {
+	if err := os.MkdirAll(filepath.Dir(b.Origin), 0777); err != nil {
+		return err
+	}
+	return fileutil.Move(b.Location, b.Origin)
+}
+
+// treeStore keeps backups in the .resize.backup directory of the base.
+type treeStore struct{}
+
+func (treeStore) Backup(base, file string, done func(Backup) error) (Backup, error) {
+	to, err := getOriginNewPath(base, file)
+	if err != nil {
+		return Backup{}, err
+	}
+	b, err := moveToBackup(file, to)
+	if err != nil || done == nil {
+		return b, err
+	}
+	return b, done(b)
+}
+
+// List also looks into the backup directories of the ancestors of path, as
+// the base of a resize is the parent of its directory argument.
+func (treeStore) List(path string) ([]Backup, error) {
+	origin := func(path string) (string, bool) {
+		origin, err := getOriginOldPath(path)
+		return origin, err == nil
+	}
+	backups, err := walkBackups(path, origin)
+	if err != nil || IsOriginBackupPath(path) {
+		return backups, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return backups, err
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(dir, abs)
+		if err != nil {
+			return backups, err
+		}
+		inner := filepath.Join(dir, backupDir, rel)
+		if _, err := os.Stat(inner); err == nil {
+			found, err := walkBackups(inner, origin)
+			backups = append(backups, found...)
+			if err != nil {
+				return backups, err
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			return backups, nil
+		}
+	}
+}
+
+func (treeStore) Open(b Backup) (io.ReadCloser, error) {
+	return openBackupFile(b)
+}
+
+func (treeStore) Restore(b Backup) error {
+	return restoreBackupFile(b)
+}
+
+func (treeStore) Remove(b Backup) error {
+	if err := os.Remove(b.Location); err != nil {
+		return err
+	}
+	paths := fileutil.SplitPath(b.Location)
+	_, index, _ := slices.FindLast(paths, filters.Equal(backupDir))
+	fileutil.RemoveEmptyDirs(filepath.Dir(b.Location), strings.Join(paths[:index], fileutil.Separator))
+	return nil
+}
+
+func (treeStore) Flush() error {
+	return nil
+}
+
+func (treeStore) Close() error {
+	return nil
+}
@@ -0,0 +1,704 @@
+package imagetool
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/util/fileutil"
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+type archiveEntry struct {
+	name    string
+	modTime time.Time
+	size    int64
+}
+
+type archiveWriter interface {
+	add(name string, modTime time.Time, size int64, r io.Reader) error
+	// copyFrom copies the entries of an existing archive except the skipped
+	// ones and returns how many it copied.
+	copyFrom(archive string, skip map[string]bool) (int, error)
+	Close() error
+}
+
+// archiveBatchSize is the number of backups after which a segment is
+// written, so the originals do not wait for the end of a long run.
+const archiveBatchSize = 64
+
+var segmentPattern = regexp.MustCompile(`^` + regexp.QuoteMeta(backupDir) + `(?:\.(\d+))?\.(zip|tar)$`)
+
+// archiveStore keeps backups in zip or tar archives at the base, one segment
+// per batch: .resize.backup.zip, .resize.backup.2.zip and so on. Backup only
+// reserves the entry, the originals of a batch are streamed into a new
+// segment, on Flush and on Close, and removed once it is written, so an
+// interrupted run loses nothing and no segment is rewritten to add backups.
+type archiveStore struct {
+	format  string
+	mutex   sync.Mutex
+	pending map[string]*pendingArchive
+}
+
+// pendingArchive holds the segments of one base.
+type pendingArchive struct {
+	dir string
+	// names maps the entries of the segments and the reserved ones to their segment.
+	names map[string]string
+	// segment is the segment new entries are reserved in, next numbers the one after.
+	segment string
+	next    int
+	// added holds the reserved entries per segment.
+	added map[string][]archiveBackup
+	// dropped holds the restored and removed entries per segment.
+	dropped map[string]map[string]bool
+	// commit serializes the writes of the segments, which run without the
+	// store mutex.
+	commit sync.Mutex
+	// broken keeps the error which left the segments unchanged together with
+	// the originals, later backups into them fail with it.
+	broken error
+}
+
+type archiveBackup struct {
+	file   string
+	backup Backup
+	done   func(Backup) error
+}
+
+// archiveBatch is the work of one commit of the segments.
+type archiveBatch struct {
+	added   map[string][]archiveBackup
+	dropped map[string]map[string]bool
+}
+
+// rotate starts the next segment for the entries reserved from now on.
+func (s *archiveStore) rotate(p *pendingArchive) {
+	p.segment = s.segmentPath(p.dir, p.next)
+	p.next++
+}
+
+// take returns the reserved entries of the full segments, or of all of them,
+// and the dropped entries.
+func (s *archiveStore) take(p *pendingArchive, all bool) archiveBatch {
+	if all && len(p.added[p.segment]) > 0 {
+		s.rotate(p)
+	}
+	batch := archiveBatch{added: make(map[string][]archiveBackup), dropped: p.dropped}
+	for segment, added := range p.added {
+		if segment != p.segment {
+			batch.added[segment] = added
+			delete(p.added, segment)
+		}
+	}
+	p.dropped = make(map[string]map[string]bool)
+	return batch
+}
+
+func (p *pendingArchive) drop(segment, name string) {
+	delete(p.names, name)
+	if p.dropped[segment] == nil {
+		p.dropped[segment] = make(map[string]bool)
+	}
+	p.dropped[segment][name] = true
+}
+
+// cancel drops the reserved entry of name, the original stays where it is.
+func (p *pendingArchive) cancel(name string) (archiveBackup, bool) {
+	segment := p.names[name]
+	for i, b := range p.added[segment] {
+		if b.backup.Location == name {
+			p.added[segment] = slices.Delete(p.added[segment], i, i+1)
+			delete(p.names, name)
+			return b, true
+		}
+	}
+	return archiveBackup{}, false
+}
+
+// IsBackupArchive reports whether file is a segment of the zip or tar backup store.
+func IsBackupArchive(file string) bool {
+	return segmentPattern.MatchString(filepath.Base(file))
+}
+
+func newArchiveStore(format string) *archiveStore {
+	return &archiveStore{format: format, pending: make(map[string]*pendingArchive)}
+}
+
+func (s *archiveStore) segmentPath(dir string, n int) string {
+	if n <= 1 {
+		return filepath.Join(dir, backupDir+"."+s.format)
+	}
+	return filepath.Join(dir, backupDir+"."+strconv.Itoa(n)+"."+s.format)
+}
+
+// segmentNumber returns the number of a segment of the store's format.
+func (s *archiveStore) segmentNumber(name string) (int, bool) {
+	m := segmentPattern.FindStringSubmatch(name)
+	if m == nil || m[2] != s.format {
+		return 0, false
+	}
+	if m[1] == "" {
+		return 1, true
+	}
+	n, err := strconv.Atoi(m[1])
+	return n, err == nil && n > 1
+}
+
+// segments returns the segments in dir ordered by their number.
+func (s *archiveStore) segments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	numbers := make([]int, 0)
+	for _, entry := range entries {
+		if n, ok := s.segmentNumber(entry.Name()); ok && entry.Type().IsRegular() {
+			numbers = append(numbers, n)
+		}
+	}
+	slices.Sort(numbers)
+	segments := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		segments = append(segments, s.segmentPath(dir, n))
+	}
+	return segments, nil
+}
+
+func (s *archiveStore) open(dir string) (*pendingArchive, error) {
+	if p, ok := s.pending[dir]; ok {
+		return p, nil
+	}
+	segments, err := s.segments(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	p := &pendingArchive{dir: dir, names: make(map[string]string), next: 1,
+		added: make(map[string][]archiveBackup), dropped: make(map[string]map[string]bool)}
+	for _, segment := range segments {
+		entries, err := readArchiveEntries(s.format, segment)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			p.names[entry.name] = segment
+		}
+		n, _ := s.segmentNumber(filepath.Base(segment))
+		p.next = n + 1
+	}
+	s.rotate(p)
+	s.pending[dir] = p
+	return p, nil
+}
+
+// lookup returns the pending segments of the backup, waiting for the commit
+// in progress, which the caller unlocks.
+func (s *archiveStore) lookup(b Backup) (*pendingArchive, error) {
+	archive, err := filepath.Abs(b.Archive)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	p, err := s.open(filepath.Dir(archive))
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	p.commit.Lock()
+	return p, nil
+}
+
+func (s *archiveStore) Backup(base, file string, done func(Backup) error) (Backup, error) {
+	dir, err := filepath.Abs(base)
+	if err != nil {
+		return Backup{}, err
+	}
+	rel, err := filepath.Rel(base, file)
+	if err != nil {
+		return Backup{}, err
+	}
+	rel = filepath.ToSlash(rel)
+	stat, err := os.Stat(file)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	s.mutex.Lock()
+	p, err := s.open(dir)
+	if err == nil && p.broken != nil {
+		err = p.broken
+	}
+	if err != nil {
+		s.mutex.Unlock()
+		return Backup{}, err
+	}
+	version := 1
+	for p.names[versionedName(rel, version)] != "" || (version == 2 && p.names[rel+legacyBackupExt] != "") {
+		version++
+	}
+	name := versionedName(rel, version)
+	b := Backup{Origin: file, Location: name, Archive: p.segment, Version: version, ModTime: stat.ModTime(), Size: stat.Size()}
+	p.names[name] = p.segment
+	p.added[p.segment] = append(p.added[p.segment], archiveBackup{file: file, backup: b, done: done})
+	full := len(p.added[p.segment]) >= archiveBatchSize
+	if full {
+		s.rotate(p)
+	}
+	s.mutex.Unlock()
+
+	if full {
+		if err := s.commit(p, false); err != nil {
+			return Backup{}, err
+		}
+	}
+	return b, nil
+}
+
+func (s *archiveStore) List(path string) ([]Backup, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]Backup, 0)
+	walked := make(map[string]bool)
+	err = filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, ok := s.segmentNumber(d.Name()); d.IsDir() || !ok {
+			return nil
+		}
+		walked[path] = true
+		found, err := s.listArchive(path)
+		backups = append(backups, found...)
+		return err
+	})
+	if err != nil {
+		return backups, err
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		segments, err := s.segments(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return backups, err
+		}
+		for _, segment := range segments {
+			if walked[segment] || segment == abs {
+				continue
+			}
+			found, err := s.listArchive(segment)
+			if err != nil {
+				return backups, err
+			}
+			for _, b := range found {
+				if isWithin(abs, b.Origin) {
+					backups = append(backups, b)
+				}
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return backups, nil
+}
+
+func (s *archiveStore) listArchive(archive string) ([]Backup, error) {
+	entries, err := readArchiveEntries(s.format, archive)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]Backup, 0, len(entries))
+	for _, entry := range entries {
+		origin, version := parseVersionedName(entry.name)
+		backups = append(backups, Backup{
+			Origin:   filepath.Join(filepath.Dir(archive), filepath.FromSlash(origin)),
+			Location: entry.name,
+			Archive:  archive,
+			Version:  version,
+			ModTime:  entry.modTime,
+			Size:     entry.size,
+		})
+	}
+	return backups, nil
+}
+
+func (s *archiveStore) Open(b Backup) (io.ReadCloser, error) {
+	return openArchiveEntry(s.format, b.Archive, b.Location)
+}
+
+// Restore of a reserved entry only cancels it, as its original is still in place.
+func (s *archiveStore) Restore(b Backup) error {
+	p, err := s.lookup(b)
+	if err != nil {
+		return err
+	}
+	defer p.commit.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := p.cancel(b.Location); ok {
+		return nil
+	}
+	segment := p.names[b.Location]
+	if segment == "" {
+		return fmt.Errorf("%w, %s in %s", myerrors.ErrNotBackup, b.Location, b.Archive)
+	}
+	reader, err := openArchiveEntry(s.format, segment, b.Location)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if err := os.MkdirAll(filepath.Dir(b.Origin), 0777); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(b.Origin, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if os.IsExist(err) {
+		return &os.LinkError{Op: "rename", Old: segment + ":" + b.Location, New: b.Origin, Err: myerrors.ErrRenameConflict}
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		os.Remove(b.Origin)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(b.Origin)
+		return err
+	}
+	if err := os.Chtimes(b.Origin, b.ModTime, b.ModTime); err != nil {
+		return err
+	}
+	p.drop(segment, b.Location)
+	return nil
+}
+
+// Remove of a reserved entry deletes its original.
+func (s *archiveStore) Remove(b Backup) error {
+	p, err := s.lookup(b)
+	if err != nil {
+		return err
+	}
+	defer p.commit.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if reserved, ok := p.cancel(b.Location); ok {
+		return os.Remove(reserved.file)
+	}
+	segment := p.names[b.Location]
+	if segment == "" {
+		return fmt.Errorf("%w, %s in %s", myerrors.ErrNotBackup, b.Location, b.Archive)
+	}
+	p.drop(segment, b.Location)
+	return nil
+}
+
+func (s *archiveStore) Flush() error {
+	s.mutex.Lock()
+	pending := make([]*pendingArchive, 0, len(s.pending))
+	for _, p := range s.pending {
+		pending = append(pending, p)
+	}
+	s.mutex.Unlock()
+	var err error
+	for _, p := range pending {
+		if e := s.commit(p, true); e != nil {
+			err = multierror.Append(err, e)
+		}
+	}
+	return err
+}
+
+func (s *archiveStore) Close() error {
+	err := s.Flush()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	clear(s.pending)
+	return err
+}
+
+// commit streams the reserved originals of the full segments, or of all,
+// into new segments, runs their done and removes them, then rewrites the
+// segments with dropped entries.
+func (s *archiveStore) commit(p *pendingArchive, all bool) error {
+	p.commit.Lock()
+	defer p.commit.Unlock()
+	s.mutex.Lock()
+	batch := s.take(p, all)
+	s.mutex.Unlock()
+	var err error
+	for segment, added := range batch.added {
+		if len(added) == 0 {
+			continue
+		}
+		e := s.writeSegment(segment, func(writer archiveWriter) (int, error) {
+			for _, b := range added {
+				if err := addArchiveBackup(writer, b); err != nil {
+					return 0, fmt.Errorf("write %s failed, %w", b.backup.Location, err)
+				}
+			}
+			return len(added), nil
+		})
+		if e != nil {
+			s.mutex.Lock()
+			if p.broken == nil {
+				p.broken = e
+			}
+			s.mutex.Unlock()
+			err = multierror.Append(err, fmt.Errorf("write backup archive %s failed, %w", segment, e))
+		} else {
+			for _, b := range added {
+				if b.done != nil {
+					if e := b.done(b.backup); e != nil {
+						err = multierror.Append(err, e)
+					}
+				}
+				if e := os.Remove(b.file); e != nil {
+					err = multierror.Append(err, e)
+				}
+			}
+		}
+	}
+	for segment, dropped := range batch.dropped {
+		e := s.writeSegment(segment, func(writer archiveWriter) (int, error) {
+			return writer.copyFrom(segment, dropped)
+		})
+		if e != nil {
+			err = multierror.Append(err, fmt.Errorf("write backup archive %s failed, %w", segment, e))
+		}
+	}
+	return err
+}
+
+// writeSegment replaces the segment with the archive written by write through
+// a synced temporary file, a segment without entries is removed.
+func (s *archiveStore) writeSegment(segment string, write func(writer archiveWriter) (int, error)) error {
+	tmp, err := os.CreateTemp(filepath.Dir(segment), filepath.Base(segment)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+	writer := newArchiveWriter(s.format, tmp)
+	written, err := write(writer)
+	if e := writer.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	if written == 0 {
+		if err := os.Remove(segment); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmp.Name(), segment)
+}
+
+func addArchiveBackup(writer archiveWriter, b archiveBackup) error {
+	file, err := os.Open(b.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return writer.add(b.backup.Location, b.backup.ModTime, b.backup.Size, file)
+}
+
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	if format == "tar" {
+		return tarWriter{tar.NewWriter(w)}
+	}
+	return zipWriter{zip.NewWriter(w)}
+}
+
+func readArchiveEntries(format string, archive string) ([]archiveEntry, error) {
+	entries := make([]archiveEntry, 0)
+	if format == "tar" {
+		file, err := os.Open(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader := tar.NewReader(file)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				return entries, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if header.Typeflag == tar.TypeReg {
+				entries = append(entries, archiveEntry{name: header.Name, modTime: header.ModTime, size: header.Size})
+			}
+		}
+	}
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if !file.Mode().IsDir() {
+			entries = append(entries, archiveEntry{name: file.Name, modTime: file.Modified, size: int64(file.UncompressedSize64)})
+		}
+	}
+	return entries, nil
+}
+
+func openArchiveEntry(format string, archive string, name string) (io.ReadCloser, error) {
+	if format == "tar" {
+		file, err := os.Open(archive)
+		if err != nil {
+			return nil, err
+		}
+		reader := tar.NewReader(file)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				file.Close()
+				return nil, fmt.Errorf("%s in %s, %w", name, archive, fs.ErrNotExist)
+			}
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+			if header.Name == name {
+				return fileutil.WithClosers(reader, file), nil
+			}
+		}
+	}
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range reader.File {
+		if file.Name == name {
+			entry, err := file.Open()
+			if err != nil {
+				reader.Close()
+				return nil, err
+			}
+			return fileutil.WithClosers(entry, reader), nil
+		}
+	}
+	reader.Close()
+	return nil, fmt.Errorf("%s in %s, %w", name, archive, fs.ErrNotExist)
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (z zipWriter) add(name string, modTime time.Time, size int64, r io.Reader) error {
+	// images are compressed already
+	w, err := z.w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (z zipWriter) copyFrom(archive string, skip map[string]bool) (int, error) {
+	reader, err := zip.OpenReader(archive)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	copied := 0
+	for _, file := range reader.File {
+		if skip[file.Name] {
+			continue
+		}
+		raw, err := file.OpenRaw()
+		if err != nil {
+			return copied, err
+		}
+		w, err := z.w.CreateRaw(&file.FileHeader)
+		if err != nil {
+			return copied, err
+		}
+		if _, err := io.Copy(w, raw); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+func (z zipWriter) Close() error {
+	return z.w.Close()
+}
+
+type tarWriter struct {
+	w *tar.Writer
+}
+
+func (t tarWriter) add(name string, modTime time.Time, size int64, r io.Reader) error {
+	header := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: size, ModTime: modTime}
+	if err := t.w.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(t.w, r)
+	return err
+}
+
+func (t tarWriter) copyFrom(archive string, skip map[string]bool) (int, error) {
+	file, err := os.Open(archive)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := tar.NewReader(file)
+	copied := 0
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+		if skip[header.Name] {
+			continue
+		}
+		if err := t.w.WriteHeader(header); err != nil {
+			return copied, err
+		}
+		if _, err := io.Copy(t.w, reader); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+}
+
+func (t tarWriter) Close() error {
+	return t.w.Close()
+}
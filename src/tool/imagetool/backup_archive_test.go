@@ -0,0 +1,261 @@
+package imagetool
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, names ...string) []string {
+	t.Helper()
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("data of "+name), 0666); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+func TestArchiveStoreFlush(t *testing.T) {
+	for _, format := range []string{"zip", "tar"} {
+		t.Run(format, func(t *testing.T) {
+			base := t.TempDir()
+			files := writeFiles(t, base, "a.jpg", "sub/b.png")
+			store := newArchiveStore(format)
+			for _, file := range files {
+				if _, err := store.Backup(base, file, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !exists(files[0]) || !exists(files[1]) {
+				t.Fatal("originals removed before the archive is written")
+			}
+			if err := store.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if exists(files[0]) || exists(files[1]) {
+				t.Fatal("originals kept after flush")
+			}
+			// a second backup of the same file gets a new version
+			writeFiles(t, base, "a.jpg")
+			b, err := store.Backup(base, files[0], nil)
+			if err != nil || b.Version != 2 {
+				t.Fatalf("Backup = %+v, %v, want version 2", b, err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+			backups, err := store.List(base)
+			if err != nil || len(backups) != 3 {
+				t.Fatalf("List = %v, %v, want 3 backups", backups, err)
+			}
+			for _, b := range backups {
+				reader, err := store.Open(b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := io.ReadAll(reader)
+				reader.Close()
+				rel, _ := filepath.Rel(base, b.Origin)
+				if err != nil || string(data) != "data of "+filepath.ToSlash(rel) {
+					t.Fatalf("backup %s holds %q, %v", b.Location, data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveStoreBatches(t *testing.T) {
+	base := t.TempDir()
+	names := make([]string, archiveBatchSize+3)
+	for i := range names {
+		names[i] = fmt.Sprintf("%03d.jpg", i)
+	}
+	files := writeFiles(t, base, names...)
+	store := newArchiveStore("zip")
+	wg := new(sync.WaitGroup)
+	for _, file := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.Backup(base, file, nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	kept := 0
+	for _, file := range files {
+		if exists(file) {
+			kept++
+		}
+	}
+	if kept != 3 {
+		t.Fatalf("%d originals left before flush, want the 3 after the first batch", kept)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := store.List(base)
+	if err != nil || len(backups) != len(files) {
+		t.Fatalf("List = %d backups, %v, want %d", len(backups), err, len(files))
+	}
+}
+
+func TestArchiveStoreRestoreAndRemove(t *testing.T) {
+	base := t.TempDir()
+	files := writeFiles(t, base, "a.jpg", "b.jpg")
+	store := newArchiveStore("zip")
+	backups := make([]Backup, 0)
+	for _, file := range files {
+		b, err := store.Backup(base, file, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backups = append(backups, b)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Restore(backups[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Remove(backups[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(files[0]) || exists(files[1]) {
+		t.Fatal("restore or remove did not apply")
+	}
+	if exists(store.segmentPath(base, 1)) {
+		t.Fatal("empty archive kept")
+	}
+}
+
+func TestArchiveStoreSegments(t *testing.T) {
+	base := t.TempDir()
+	names := make([]string, archiveBatchSize+1)
+	for i := range names {
+		names[i] = fmt.Sprintf("%03d.jpg", i)
+	}
+	files := writeFiles(t, base, names...)
+	store := newArchiveStore("zip")
+	recorded := make([]Backup, 0)
+	done := func(b Backup) error {
+		// the record follows the entry into its segment
+		entries, err := readArchiveEntries("zip", b.Archive)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(entries, func(e archiveEntry) bool { return e.name == b.Location }) {
+			return fmt.Errorf("%s recorded before it is in %s", b.Location, b.Archive)
+		}
+		recorded = append(recorded, b)
+		return nil
+	}
+	for _, file := range files {
+		if _, err := store.Backup(base, file, done); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, second := store.segmentPath(base, 1), store.segmentPath(base, 2)
+	if len(recorded) != archiveBatchSize || exists(second) {
+		t.Fatalf("%d recorded after the first batch, want %d in %s only", len(recorded), archiveBatchSize, first)
+	}
+	stat, err := os.Stat(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != len(files) || recorded[len(files)-1].Archive != second {
+		t.Fatalf("%d recorded after flush, want %d with the last in %s", len(recorded), len(files), second)
+	}
+	if after, err := os.Stat(first); err != nil || !after.ModTime().Equal(stat.ModTime()) || after.Size() != stat.Size() {
+		t.Fatalf("%s rewritten by the second batch", first)
+	}
+	// a restore rewrites only its own segment
+	if err := store.Restore(recorded[len(files)-1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if exists(second) || !exists(files[len(files)-1]) {
+		t.Fatalf("restore of the only entry of %s did not remove it", second)
+	}
+	if after, err := os.Stat(first); err != nil || after.Size() != stat.Size() {
+		t.Fatalf("%s rewritten by a restore from %s", first, second)
+	}
+	backups, err := store.List(base)
+	if err != nil || len(backups) != archiveBatchSize {
+		t.Fatalf("List = %d backups, %v, want %d", len(backups), err, archiveBatchSize)
+	}
+}
+
+func TestArchiveStoreCancel(t *testing.T) {
+	base := t.TempDir()
+	files := writeFiles(t, base, "a.jpg", "b.jpg")
+	store := newArchiveStore("tar")
+	recorded := 0
+	done := func(Backup) error {
+		recorded++
+		return nil
+	}
+	backups := make([]Backup, 0)
+	for _, file := range files {
+		b, err := store.Backup(base, file, done)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backups = append(backups, b)
+	}
+	if err := store.Restore(backups[0]); err != nil {
+		t.Fatalf("Restore of a reserved entry = %v", err)
+	}
+	if err := store.Remove(backups[1]); err != nil {
+		t.Fatalf("Remove of a reserved entry = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(files[0]) || exists(files[1]) || recorded != 0 {
+		t.Fatalf("restored %v, removed %v, %d recorded", exists(files[0]), !exists(files[1]), recorded)
+	}
+	if exists(store.segmentPath(base, 1)) {
+		t.Fatal("segment written without entries")
+	}
+}
+
+func TestIsBackupArchive(t *testing.T) {
+	for name, want := range map[string]bool{
+		".resize.backup.zip":       true,
+		".resize.backup.tar":       true,
+		".resize.backup.12.zip":    true,
+		".resize.backup.x.zip":     false,
+		"photos.zip":               false,
+		".resize.backup.zip.1.tmp": false,
+	} {
+		if got := IsBackupArchive(filepath.Join("dir", name)); got != want {
+			t.Errorf("IsBackupArchive(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package imagetool
+
+import (
+	"ImageZipResize/util/fileutil"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// mirrorStore keeps backups under a central root, at the absolute path of the
+// original file, so one root serves every tree.
+type mirrorStore struct {
+	root string
+}
+
+func (s *mirrorStore) mirrorPath(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	volume := filepath.VolumeName(abs)
+	return filepath.Join(s.root, strings.TrimSuffix(volume, ":"), abs[len(volume):]), nil
+}
+
+func (s *mirrorStore) originPath(path string) (string, bool) {
+	if !isWithin(s.root, path) {
+		return "", false
+	}
+	rel, _ := filepath.Rel(s.root, path)
+	if runtime.GOOS == "windows" {
+		volume, rest, _ := strings.Cut(rel, string(filepath.Separator))
+		return volume + ":" + string(filepath.Separator) + rest, true
+	}
+	return string(filepath.Separator) + rel, true
+}
+
+func (s *mirrorStore) Backup(base, file string, done func(Backup) error) (Backup, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return Backup{}, err
+	}
+	to, err := s.mirrorPath(abs)
+	if err != nil {
+		return Backup{}, err
+	}
+	b, err := moveToBackup(abs, to)
+	if err != nil || done == nil {
+		return b, err
+	}
+	return b, done(b)
+}
+
+func (s *mirrorStore) List(path string) ([]Backup, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, inside := s.originPath(dir); !inside {
+		dir, err = s.mirrorPath(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return walkBackups(dir, s.originPath)
+}
+
+func (s *mirrorStore) Open(b Backup) (io.ReadCloser, error) {
+	return openBackupFile(b)
+}
+
+func (s *mirrorStore) Restore(b Backup) error {
+	return restoreBackupFile(b)
+}
+
+func (s *mirrorStore) Remove(b Backup) error {
+	if err := os.Remove(b.Location); err != nil {
+		return err
+	}
+	fileutil.RemoveEmptyDirs(filepath.Dir(b.Location), s.root)
+	return nil
+}
+
+func (s *mirrorStore) Flush() error {
+	return nil
+}
+
+func (s *mirrorStore) Close() error {
+	return nil
+}
@@ -1,12 +1,13 @@
 package imagetool
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"image/color/palette"
 	"image/draw"
 	"image/gif"
-	"log"
+	"log/slog"
 	"reflect"
 )
 
@@ -50,7 +51,7 @@ func resolveGifDisposals(img *gif.GIF) {
 	}
 }
 
-func optimizeDisposalGif(img *gif.GIF) {
+func optimizeDisposalGif(logger *slog.Logger, img *gif.GIF) {
 	for i := len(img.Image) - 1; i >= 2; i-- {
 		prevBounds := differenceBounds(img.Image[i-1], img.Image[i])
 		skipBounds := differenceBounds(img.Image[i-2], img.Image[i])
@@ -69,7 +70,9 @@ func optimizeDisposalGif(img *gif.GIF) {
 	for i, frame := range img.Image {
 		old := len(frame.Palette)
 		optimizePalette(frame)
-		log.Printf("bounds %d: %v | %v %d%% palette: %d -> %d", i, img.Image[0].Bounds(), frame.Bounds(), 100*areaOfRectangle(frame.Bounds())/areaOfRectangle(img.Image[0].Bounds()), old, len(frame.Palette))
+		logger.Debug("optimize gif frame", "frame", i, "canvas", img.Image[0].Bounds(), "bounds", frame.Bounds(),
+			"area", fmt.Sprintf("%d%%", 100*areaOfRectangle(frame.Bounds())/areaOfRectangle(img.Image[0].Bounds())),
+			"palette", fmt.Sprintf("%d -> %d", old, len(frame.Palette)))
 	}
 }
 
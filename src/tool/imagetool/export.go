@@ -1,11 +1,12 @@
 package imagetool
 
 import (
+	"ImageZipResize/myerrors"
 	"ImageZipResize/util/fileutil"
 	"ImageZipResize/util/filters"
 	"ImageZipResize/util/slices"
 	"archive/zip"
-	"errors"
+	"fmt"
 	"image"
 	"image/gif"
 	"image/jpeg"
@@ -16,10 +17,12 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	backupDir = ".resize.backup"
+	dedupeDir = ".resize.dedupe"
 	resizeTag = ".resized"
 
 	extGIF       = ".gif"
@@ -32,7 +35,6 @@ const (
 )
 
 var exportLock sync.Mutex
-var backupLock sync.Mutex
 var supportedFileExt = map[string]bool{
 	extGIF:       true,
 	extJPEG:      true,
@@ -57,19 +59,40 @@ func IsOriginBackupPath(filename string) bool {
 	return slices.Any(paths, filters.Equal(backupDir))
 }
 
+// IsDuplicatePath reports whether filename lies in a directory of moved duplicates.
+func IsDuplicatePath(filename string) bool {
+	paths := fileutil.SplitPath(filename)
+	return slices.Any(paths, filters.Equal(dedupeDir))
+}
+
 func getResizedName(filename, newExt string) string {
 	ext := filepath.Ext(filename)
 	return filepath.Clean(strings.TrimSuffix(filename, ext) + resizeTag + newExt)
 }
 
+// FindResized returns the resized image of an origin, trying the extensions
+// a resize may produce.
+func FindResized(origin string) (string, bool) {
+	exts := []string{extWEBP, filepath.Ext(origin), extJPEG, extPNG, extGIF}
+	if IsSupportedArchiveFilename(origin) {
+		exts = []string{archiveOutputExt(origin)}
+	}
+	for _, ext := range exts {
+		resized := getResizedName(origin, ext)
+		if filters.PathIsRegularFile(resized) {
+			return resized, true
+		}
+	}
+	return "", false
+}
+
 func getOriginOldPath(filename string) (string, error) {
 	paths := fileutil.SplitPath(filename)
 	_, index, found := slices.FindLast(paths, filters.Equal(backupDir))
 	if !found {
-		return "", errors.New("cannot get origin anchor")
+		return "", myerrors.ErrNotBackup
 	}
-	newPaths := append(paths[:index], paths[index+1:]...)
-	return filepath.Join(newPaths...), nil
+	return filepath.Join(strings.Join(paths[:index], fileutil.Separator), strings.Join(paths[index+1:], fileutil.Separator)), nil
 }
 
 func getOriginNewPath(base, filename string) (string, error) {
@@ -91,27 +114,10 @@ func isFileExist(file string) (bool, error) {
 	return true, nil
 }
 
-func backupOriginFile(base, from string) error {
-	to, err := getOriginNewPath(base, from)
-	if err != nil {
-		return err
-	}
-	backupLock.Lock()
-	defer backupLock.Unlock()
-	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
-		return err
-	}
-	isExist, err := isFileExist(to)
-	if err != nil {
-		return err
-	}
-	if isExist {
-		return os.Rename(from, to+".backup")
-	}
-	return os.Rename(from, to)
-}
-
-func backupOrKeepOrigin(base, from string, to string) (float64, error) {
+// backupOrKeepOrigin keeps the smaller one of the origin and the resized image,
+// a replaced origin goes into the store and is recorded in the manifest once
+// the store holds it.
+func backupOrKeepOrigin(store BackupStore, record Record, base, from string, to string) (float64, error) {
 	fromStat, err := os.Stat(from)
 	if err != nil {
 		return 0, err
@@ -123,19 +129,33 @@ func backupOrKeepOrigin(base, from string, to string) (float64, error) {
 	result := float64(toStat.Size()) / float64(fromStat.Size())
 	//return result, nil
 	if result < 1 {
-		if err := backupOriginFile(base, from); err != nil {
+		record.Size, record.Resized, record.ResizedSize = fromStat.Size(), to, toStat.Size()
+		_, err := store.Backup(base, from, func(b Backup) error {
+			record.Time, record.Origin, record.Version = time.Now(), b.Origin, b.Version
+			if err := appendRecord(base, record); err != nil {
+				return fmt.Errorf("record backup of %s failed, %w", from, err)
+			}
+			return nil
+		})
+		if err != nil {
 			return 0, err
 		}
 		return result, nil
 	}
 	os.Remove(to)
-	if err := os.Rename(from, getResizedName(from, path.Ext(from))); err != nil {
+	kept := getResizedName(from, path.Ext(from))
+	if err := fileutil.Rename(from, kept); err != nil {
 		return 0, err
 	}
+	record.Time, record.Origin, record.Kept = time.Now(), from, true
+	record.Size, record.Resized, record.ResizedSize = fromStat.Size(), kept, fromStat.Size()
+	if err := appendRecord(base, record); err != nil {
+		return 1, fmt.Errorf("record kept origin %s failed, %w", from, err)
+	}
 	return 1, nil
 }
 
-func writeResizedRGBImage(base, originFilename string, img image.Image) (float64, error) {
+func writeResizedRGBImage(store BackupStore, record Record, base, originFilename string, img image.Image) (float64, error) {
 	toPath := getResizedName(originFilename, extJPEG)
 	toFile, err := os.Create(toPath)
 	if err != nil {
@@ -148,10 +168,10 @@ func writeResizedRGBImage(base, originFilename string, img image.Image) (float64
 		return 0, err
 	}
 	toFile.Close()
-	return backupOrKeepOrigin(base, originFilename, toPath)
+	return backupOrKeepOrigin(store, record, base, originFilename, toPath)
 }
 
-func writeResizedRGBAImage(base, originFilename string, img image.Image) (float64, error) {
+func writeResizedRGBAImage(store BackupStore, record Record, base, originFilename string, img image.Image) (float64, error) {
 	toPath := getResizedName(originFilename, extPNG)
 	toFile, err := os.Create(toPath)
 	if err != nil {
@@ -164,10 +184,10 @@ func writeResizedRGBAImage(base, originFilename string, img image.Image) (float6
 		return 0, err
 	}
 	toFile.Close()
-	return backupOrKeepOrigin(base, originFilename, toPath)
+	return backupOrKeepOrigin(store, record, base, originFilename, toPath)
 }
 
-func writeResizedGIFImage(base, originFilename string, img *gif.GIF) (float64, error) {
+func writeResizedGIFImage(store BackupStore, record Record, base, originFilename string, img *gif.GIF) (float64, error) {
 	toPath := getResizedName(originFilename, extGIF)
 	toFile, err := os.Create(toPath)
 	if err != nil {
@@ -180,7 +200,7 @@ func writeResizedGIFImage(base, originFilename string, img *gif.GIF) (float64, e
 		return 0, err
 	}
 	toFile.Close()
-	return backupOrKeepOrigin(base, originFilename, toPath)
+	return backupOrKeepOrigin(store, record, base, originFilename, toPath)
 }
 
 //func writeResizedGIFImage(creator ImageCreator, img *gif.GIF) error {
@@ -207,33 +227,16 @@ func newGIFWriter(img *gif.GIF) ImageWriter {
 	}
 }
 
-func isZipFile(filename string) bool {
-	return filepath.Ext(filename) == extZip
-}
-
-func scanZipFile(filename string) (bool, error) {
-	reader, err := zip.OpenReader(filename)
-	if err != nil {
-		return false, err
-	}
-	defer reader.Close()
-	for _, file := range reader.Reader.File {
-		if IsSupportedImageFilename(file.Name) {
-			return true, nil
-		}
-	}
-	return false, nil
-}
-
 type ImageConverter func() ImageWriter
 type ImageLoader func() (io.ReadCloser, error)
 type ImageCreator func() (io.WriteCloser, error)
 type ImageWriter func(creator ImageCreator) error
 type ImageBackup func() error
 
-func fileBackup(base string, filename string) ImageBackup {
+func fileBackup(store BackupStore, base string, filename string) ImageBackup {
 	return func() error {
-		return backupOriginFile(base, filename)
+		_, err := store.Backup(base, filename, nil)
+		return err
 	}
 }
 
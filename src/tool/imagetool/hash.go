@@ -0,0 +1,117 @@
+package imagetool
+
+import (
+	"crypto/sha256"
+	"image"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// Hashes identify an image, Sum the exact bytes of the file, DHash and PHash
+// its content so that resized or re-encoded copies stay close.
+type Hashes struct {
+	Sum   [sha256.Size]byte
+	DHash uint64
+	PHash uint64
+}
+
+// Distance counts the differing bits of two perceptual hashes.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Hash computes the hashes of an image, animated images by their first frame.
+func Hash(filename string) (Hashes, error) {
+	var h Hashes
+	file, err := os.Open(filename)
+	if err != nil {
+		return h, err
+	}
+	defer file.Close()
+	sum := sha256.New()
+	img, format, err := image.Decode(io.TeeReader(file, sum))
+	if err != nil {
+		return h, decodeError(filename, format, err)
+	}
+	if _, err := io.Copy(sum, file); err != nil {
+		return h, err
+	}
+	copy(h.Sum[:], sum.Sum(nil))
+	gray := imaging.Grayscale(img)
+	h.DHash = dHash(gray)
+	h.PHash = pHash(gray)
+	return h, nil
+}
+
+// dHash compares the brightness of horizontally adjacent pixels of a 9x8 thumbnail.
+func dHash(img image.Image) uint64 {
+	small := imaging.Resize(img, 9, 8, imaging.Box)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.Pix[small.PixOffset(x, y)] < small.Pix[small.PixOffset(x+1, y)] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// pHash compares the lowest 8x8 frequencies of the DCT of a 32x32 thumbnail
+// against their median.
+func pHash(img image.Image) uint64 {
+	const size, low = 32, 8
+	small := imaging.Resize(img, size, size, imaging.Box)
+	pixels := make([][]float64, size)
+	for y := range pixels {
+		pixels[y] = make([]float64, size)
+		for x := range pixels[y] {
+			pixels[y][x] = float64(small.Pix[small.PixOffset(x, y)])
+		}
+	}
+	cosines := make([][]float64, low)
+	for u := range cosines {
+		cosines[u] = make([]float64, size)
+		for x := range cosines[u] {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * size))
+		}
+	}
+	// rows first, then columns, of the lowest frequencies only
+	rows := make([][]float64, size)
+	for y := range rows {
+		rows[y] = make([]float64, low)
+		for u := 0; u < low; u++ {
+			for x := 0; x < size; x++ {
+				rows[y][u] += pixels[y][x] * cosines[u][x]
+			}
+		}
+	}
+	coefficients := make([]float64, 0, low*low)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				sum += rows[y][u] * cosines[v][y]
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+	// the DC coefficient is the mean brightness, which is left out of the median
+	sorted := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	var hash uint64
+	for _, c := range coefficients {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
@@ -0,0 +1,170 @@
+package imagetool
+
+import (
+	"ImageZipResize/util/system"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	// magick keeps every pixel as 4 channels of 16 bits in its pixel cache,
+	// and needs about the same again for the resized result and the coalesced frames.
+	magickBytesPerPixel = 16
+	magickBaseMemory    = 32 * 1024 * 1024
+)
+
+type ImageInfo struct {
+	Format string
+	Width  int
+	Height int
+	Frames int
+	// Images counts the images of an archive, whose size is the one of its
+	// largest image.
+	Images int
+}
+
+func (info ImageInfo) Pixels() int64 {
+	return info.imagePixels() * int64(max(1, info.Images))
+}
+
+func (info ImageInfo) imagePixels() int64 {
+	return int64(info.Width) * int64(info.Height) * int64(max(1, info.Frames))
+}
+
+func (info ImageInfo) IsAnimated() bool {
+	return info.Frames > 1
+}
+
+// EstimateMemory predicts the memory magick needs to resize the image, or the
+// largest image of an archive.
+func (info ImageInfo) EstimateMemory() system.ByteSize {
+	return system.ByteSize(info.imagePixels()*magickBytesPerPixel + magickBaseMemory)
+}
+
+// Inspect reads the size and the frame count of an image without decoding the pixels.
+func Inspect(filename string) (info ImageInfo, err error) {
+	if IsSupportedArchiveFilename(filename) {
+		return inspectArchive(filename)
+	}
+	conf, format, err := loadImageConfig(filename)
+	if err != nil {
+		return info, err
+	}
+	info = ImageInfo{Format: format, Width: conf.Width, Height: conf.Height, Frames: 1}
+	switch format {
+	case "gif":
+		info.Frames, _ = countFrames(filename, countGifFrames)
+	case "webp":
+		info.Frames, _ = countFrames(filename, countWebpFrames)
+	}
+	// a broken frame list is left to magick, which reads what it can
+	info.Frames = max(1, info.Frames)
+	return info, nil
+}
+
+func countFrames(filename string, counter func(r *bufio.Reader) (int, error)) (int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return counter(bufio.NewReader(file))
+}
+
+// countGifFrames counts the image descriptors of a gif, a gif cut off after
+// its first frame ends where its data ends.
+func countGifFrames(r *bufio.Reader) (int, error) {
+	frames, err := readGifFrames(r)
+	if frames > 0 && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		return frames, nil
+	}
+	return frames, err
+}
+
+func readGifFrames(r *bufio.Reader) (int, error) {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	if flags := header[10]; flags&0x80 != 0 {
+		if _, err := r.Discard(3 << ((flags & 0x07) + 1)); err != nil {
+			return 0, err
+		}
+	}
+	frames := 0
+	for {
+		block, err := r.ReadByte()
+		if err != nil {
+			return frames, err
+		}
+		switch block {
+		case 0x21:
+			if _, err := r.Discard(1); err != nil {
+				return frames, err
+			}
+		case 0x2c:
+			frames++
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(r, descriptor); err != nil {
+				return frames, err
+			}
+			if flags := descriptor[8]; flags&0x80 != 0 {
+				if _, err := r.Discard(3 << ((flags & 0x07) + 1)); err != nil {
+					return frames, err
+				}
+			}
+			if _, err := r.Discard(1); err != nil {
+				return frames, err
+			}
+		case 0x3b:
+			return frames, nil
+		default:
+			return frames, errors.New("gif: unknown block")
+		}
+		if err := skipGifSubBlocks(r); err != nil {
+			return frames, err
+		}
+	}
+}
+
+func skipGifSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+func countWebpFrames(r *bufio.Reader) (int, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	frames := 0
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				return frames, nil
+			}
+			return frames, err
+		}
+		if string(chunk[:4]) == "ANMF" {
+			frames++
+		}
+		size := binary.LittleEndian.Uint32(chunk[4:])
+		if _, err := r.Discard(int(size + size&1)); err != nil {
+			return frames, err
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package imagetool
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testGif(t *testing.T, frames int) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 4, 3), palette))
+		g.Delay = append(g.Delay, 1)
+	}
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCountGifFrames(t *testing.T) {
+	data := testGif(t, 3)
+	frames, err := countGifFrames(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil || frames != 3 {
+		t.Fatalf("countGifFrames = %d, %v, want 3", frames, err)
+	}
+	// without the trailer
+	frames, err = countGifFrames(bufio.NewReader(bytes.NewReader(data[:len(data)-1])))
+	if err != nil || frames != 3 {
+		t.Fatalf("countGifFrames without trailer = %d, %v, want 3", frames, err)
+	}
+	if _, err := countGifFrames(bufio.NewReader(bytes.NewReader(data[:12]))); err == nil {
+		t.Fatal("countGifFrames of a cut header succeeded")
+	}
+}
+
+func TestInspectTruncatedGif(t *testing.T) {
+	data := testGif(t, 2)
+	file := filepath.Join(t.TempDir(), "cut.gif")
+	// cut in the middle of the second frame
+	if err := os.WriteFile(file, data[:len(data)-8], 0666); err != nil {
+		t.Fatal(err)
+	}
+	info, err := Inspect(file)
+	if err != nil {
+		t.Fatalf("Inspect = %v", err)
+	}
+	if info.Width != 4 || info.Height != 3 || info.Frames < 1 {
+		t.Fatalf("Inspect = %+v", info)
+	}
+}
@@ -1,6 +1,8 @@
 package imagetool
 
 import (
+	"ImageZipResize/myerrors"
+	"errors"
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/tiff"
 	"golang.org/x/image/webp"
@@ -9,6 +11,8 @@ import (
 	"image/jpeg"
 	"image/png"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 func init() {
@@ -20,13 +24,28 @@ func init() {
 	_ = bmp.Decode
 }
 
+// decodeError wraps the error of a decoder, an unknown format yields ErrNotImage.
+func decodeError(filename string, format string, err error) error {
+	if errors.Is(err, image.ErrFormat) {
+		return myerrors.ErrNotImage
+	}
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	return &myerrors.DecodeError{Format: format, Err: err}
+}
+
 func loadImageConfig(filename string) (conf image.Config, format string, err error) {
 	reader, err := os.Open(filename)
 	if err != nil {
 		return conf, format, err
 	}
 	defer reader.Close()
-	return image.DecodeConfig(reader)
+	conf, format, err = image.DecodeConfig(reader)
+	if err != nil {
+		err = decodeError(filename, format, err)
+	}
+	return
 }
 
 func loadStaticImage(filename string) (img image.Image, err error) {
@@ -35,7 +54,10 @@ func loadStaticImage(filename string) (img image.Image, err error) {
 		return nil, err
 	}
 	defer reader.Close()
-	img, _, err = image.Decode(reader)
+	img, format, err := image.Decode(reader)
+	if err != nil {
+		return nil, decodeError(filename, format, err)
+	}
 	return
 }
 
@@ -45,7 +67,11 @@ func loadGifImage(filename string) (*gif.GIF, error) {
 		return nil, err
 	}
 	defer reader.Close()
-	return gif.DecodeAll(reader)
+	img, err := gif.DecodeAll(reader)
+	if err != nil {
+		return nil, decodeError(filename, "gif", err)
+	}
+	return img, nil
 }
 
 func isGifImage(filename string) (bool, error) {
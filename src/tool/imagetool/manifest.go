@@ -0,0 +1,167 @@
+package imagetool
+
+import (
+	"bufio"
+	"encoding/json"
+	"image"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const manifestName = ".resize.manifest.jsonl"
+
+var manifestLock sync.Mutex
+
+// Record describes one resize which replaced its origin by a resized image,
+// it is appended to the manifest at the base of the resize. Paths are kept
+// relative to the manifest.
+type Record struct {
+	Run         string    `json:"run,omitempty"`
+	Target      string    `json:"target,omitempty"`
+	Time        time.Time `json:"time"`
+	Origin      string    `json:"origin"`
+	Version     int       `json:"version"`
+	Size        int64     `json:"size"`
+	Resized     string    `json:"resized"`
+	ResizedSize int64     `json:"resizedSize"`
+	// Kept tells the origin was smaller and only renamed to the resized name,
+	// there is no backup then.
+	Kept bool `json:"kept,omitempty"`
+}
+
+func newRecord(run string, to image.Point, mode Mode) Record {
+	return Record{Run: run, Target: magickResizeOption(to, mode)}
+}
+
+// Rate is the size of the resized image relative to its origin.
+func (r Record) Rate() float64 {
+	if r.Size == 0 {
+		return 1
+	}
+	return float64(r.ResizedSize) / float64(r.Size)
+}
+
+func IsManifestPath(file string) bool {
+	return filepath.Base(file) == manifestName
+}
+
+func appendRecord(base string, r Record) error {
+	dir := filepath.Clean(base)
+	r.Origin = relativeTo(dir, r.Origin)
+	r.Resized = relativeTo(dir, r.Resized)
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	manifestLock.Lock()
+	defer manifestLock.Unlock()
+	file, err := os.OpenFile(filepath.Join(dir, manifestName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func relativeTo(dir, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	rel, err := filepath.Rel(absDir, abs)
+	if err != nil {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+type recordKey struct {
+	origin  string
+	version int
+}
+
+type manifestIndex struct {
+	backups map[recordKey]Record
+	resized map[string]Record
+}
+
+// Manifests finds the records of backups and resized images, reading the
+// manifests of their ancestors once.
+type Manifests struct {
+	mutex   sync.Mutex
+	indexes map[string]*manifestIndex
+}
+
+func NewManifests() *Manifests {
+	return &Manifests{indexes: make(map[string]*manifestIndex)}
+}
+
+// Lookup returns the latest record of the backup, searching the manifests
+// from the directory of its origin upwards.
+func (m *Manifests) Lookup(b Backup) (Record, bool) {
+	return m.find(b.Origin, func(index *manifestIndex, abs string) (Record, bool) {
+		r, ok := index.backups[recordKey{origin: abs, version: b.Version}]
+		return r, ok
+	})
+}
+
+// LookupResized returns the latest record which produced the resized image.
+func (m *Manifests) LookupResized(resized string) (Record, bool) {
+	return m.find(resized, func(index *manifestIndex, abs string) (Record, bool) {
+		r, ok := index.resized[abs]
+		return r, ok
+	})
+}
+
+func (m *Manifests) find(path string, get func(index *manifestIndex, abs string) (Record, bool)) (Record, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Record{}, false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		if r, ok := get(m.load(dir), abs); ok {
+			return r, true
+		}
+		if filepath.Dir(dir) == dir {
+			return Record{}, false
+		}
+	}
+}
+
+func (m *Manifests) load(dir string) *manifestIndex {
+	if index, ok := m.indexes[dir]; ok {
+		return index
+	}
+	index := &manifestIndex{backups: make(map[recordKey]Record), resized: make(map[string]Record)}
+	m.indexes[dir] = index
+	file, err := os.Open(filepath.Join(dir, manifestName))
+	if err != nil {
+		return index
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) != nil {
+			continue
+		}
+		r.Origin = filepath.Join(dir, filepath.FromSlash(r.Origin))
+		r.Resized = filepath.Join(dir, filepath.FromSlash(r.Resized))
+		if !r.Kept {
+			index.backups[recordKey{origin: r.Origin, version: r.Version}] = r
+		}
+		index.resized[r.Resized] = r
+	}
+	return index
+}
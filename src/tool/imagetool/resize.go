@@ -1,9 +1,11 @@
 package imagetool
 
 import (
+	"ImageZipResize/myerrors"
 	"ImageZipResize/util/fileutil"
 	"ImageZipResize/util/system"
 	"archive/zip"
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/disintegration/imaging"
@@ -14,9 +16,11 @@ import (
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 )
 
 type Mode struct {
@@ -49,17 +53,19 @@ func (m Mode) DoNotEnlarge() Mode {
 	return m
 }
 
-func Resize(base string, filename string, isCover bool, to image.Point, mode Mode, mem system.ByteSize) (float64, error) {
+// Resize resizes the image with magick and moves the origin into the store
+// when the result is smaller, the backup is recorded with the run id.
+func Resize(logger *slog.Logger, store BackupStore, run string, base string, filename string, isCover bool, to image.Point, mode Mode, mem system.ByteSize) (float64, error) {
 	if IsResizedPath(filename) {
-		return 0, errors.New("file is already resized")
+		return 0, myerrors.ErrAlreadyResized
 	}
-	//if isZipFile(filename) {
-	//	return resizeImagesInZip(base, filename, to, mode)
-	//}
-	if !IsImageFile(filename) {
-		return 0, errors.New("file is not an image")
+	if IsSupportedArchiveFilename(filename) {
+		return resizeArchive(logger, store, run, base, filename, to, mode, mem)
+	}
+	if _, _, err := loadImageConfig(filename); err != nil {
+		return 0, err
 	}
-	return resizeMagick(base, filename, isCover, to, mode, mem)
+	return resizeMagick(logger, store, run, base, filename, isCover, to, mode, mem)
 	//isGif, err := isGifImage(filename)
 	//if err != nil {
 	//	return 0, err
@@ -70,48 +76,45 @@ func Resize(base string, filename string, isCover bool, to image.Point, mode Mod
 	//return resizeStatic(base, filename, to, mode)
 }
 
-func resizeImagesInZip(base string, filename string, to image.Point, mode Mode) error {
-	ok, err := scanZipFile(filename)
+// resizeArchive rewrites an archive as a zip whose images are resized by
+// magick within the memory, the entries keep their order and times, and the
+// others like ComicInfo.xml are copied unchanged. The first image keeps its
+// format as the cover of the archive.
+func resizeArchive(logger *slog.Logger, store BackupStore, run string, base string, filename string, to image.Point, mode Mode, mem system.ByteSize) (float64, error) {
+	src, err := OpenArchive(filename)
 	if err != nil {
-		return err
-	}
-	if !ok {
-		// skip zip files without images
-		return nil
+		return 0, err
 	}
-	src, err := zip.OpenReader(filename)
+	defer src.Close()
+	tmp, err := fileutil.GetTempDir(base, filename)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer src.Close()
-	dstFile, err := os.Create(getResizedName(filename, extZip))
+	defer os.RemoveAll(tmp)
+	toPath := getResizedName(filename, archiveOutputExt(filename))
+	toFile, err := os.Create(toPath)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer dstFile.Close()
-	dst := zip.NewWriter(dstFile)
-	defer dst.Close()
-	for _, file := range src.Reader.File {
-		if !IsSupportedImageFilename(file.Name) {
-			srcItem, err := file.OpenRaw()
-			if err != nil {
-				return err
-			}
-			dstItem, err := dst.CreateRaw(&file.FileHeader)
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(dstItem, srcItem); err != nil {
-				return err
-			}
-			continue
-		}
-
+	dst := zip.NewWriter(toFile)
+	images, err := resizeArchiveEntries(logger, src, dst, to, mode, mem, tmp)
+	if err == nil {
+		err = dst.Close()
 	}
-	return nil
+	if closeErr := toFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && images == 0 {
+		err = myerrors.ErrNoArchiveImages
+	}
+	if err != nil {
+		os.Remove(toPath)
+		return 0, err
+	}
+	return backupOrKeepOrigin(store, newRecord(run, to, mode), base, filename, toPath)
 }
 
-func resizeGIF(base string, filename string, to image.Point, mode Mode) (float64, error) {
+func resizeGIF(logger *slog.Logger, store BackupStore, run string, base string, filename string, to image.Point, mode Mode) (float64, error) {
 	img, err := loadGifImage(filename)
 	if err != nil {
 		return 0, err
@@ -124,8 +127,8 @@ func resizeGIF(base string, filename string, to image.Point, mode Mode) (float64
 		}
 		img.Image[i] = toPalettedImage(result, origin.Palette)
 	}
-	optimizeDisposalGif(img)
-	return writeResizedGIFImage(base, filename, img)
+	optimizeDisposalGif(logger, img)
+	return writeResizedGIFImage(store, newRecord(run, to, mode), base, filename, img)
 	//if err := backupOriginFile(base, filename); err != nil {
 	//	return err
 	//}
@@ -134,7 +137,7 @@ func resizeGIF(base string, filename string, to image.Point, mode Mode) (float64
 	//return writer(creator)
 }
 
-func resizeGif(reader io.Reader, to image.Point, mode Mode) (ImageWriter, error) {
+func resizeGif(logger *slog.Logger, reader io.Reader, to image.Point, mode Mode) (ImageWriter, error) {
 	img, err := gif.DecodeAll(reader)
 	if err != nil {
 		return nil, err
@@ -147,11 +150,11 @@ func resizeGif(reader io.Reader, to image.Point, mode Mode) (ImageWriter, error)
 		}
 		img.Image[i] = toPalettedImage(result, origin.Palette)
 	}
-	optimizeDisposalGif(img)
+	optimizeDisposalGif(logger, img)
 	return newGIFWriter(img), nil
 }
 
-func resizeMagick(base string, filename string, isCover bool, to image.Point, mode Mode, mem system.ByteSize) (float64, error) {
+func resizeMagick(logger *slog.Logger, store BackupStore, run string, base string, filename string, isCover bool, to image.Point, mode Mode, mem system.ByteSize) (float64, error) {
 	ext := extWEBP
 	if isCover {
 		ext = path.Ext(filename)
@@ -163,17 +166,46 @@ func resizeMagick(base string, filename string, isCover bool, to image.Point, mo
 		return 0, err
 	}
 	defer os.RemoveAll(tmp)
+	if err := runMagick(logger, cmd, filename, mem, tmp); err != nil {
+		os.Remove(toPath)
+		return 0, err
+	}
+	return backupOrKeepOrigin(store, newRecord(run, to, mode), base, filename, toPath)
+}
+
+// resizeMagickData resizes an image in memory, piping it through magick with
+// the formats named by the extensions.
+func resizeMagickData(logger *slog.Logger, name string, data []byte, ext, newExt string, to image.Point, mode Mode, mem system.ByteSize, tmp string) ([]byte, error) {
+	from := strings.TrimPrefix(strings.ToLower(ext), ".") + ":-"
+	into := strings.TrimPrefix(strings.ToLower(newExt), ".") + ":-"
+	cmd := exec.Command("magick", from, "-strip", "-coalesce", "-resize", magickResizeOption(to, mode), "-quality", "90", "-define", "webp:near-lossless=90", into)
+	cmd.Stdin = bytes.NewReader(data)
+	stdout := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	if err := runMagick(logger, cmd, name, mem, tmp); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// runMagick runs magick within the memory, spilling its pixel cache into tmp.
+func runMagick(logger *slog.Logger, cmd *exec.Cmd, name string, mem system.ByteSize, tmp string) error {
 	cmd.Env = append(os.Environ(),
 		fmt.Sprintf("MAGICK_MEMORY_LIMIT=%s", mem),
 		fmt.Sprintf("MAGICK_MAP_LIMIT=%s", mem),
 		fmt.Sprintf("MAGICK_DISK_LIMIT=%s", mem),
 		fmt.Sprintf("MAGICK_TEMPORARY_PATH=%s", tmp))
-	//log.Printf("command: %s", strings.Join(cmd.Args, " "))
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	logger.Debug("run magick", "path", name, "command", strings.Join(cmd.Args, " "), "memory", mem)
 	if err := cmd.Run(); err != nil {
-		os.Remove(toPath)
-		return 0, err
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return &myerrors.MagickError{ExitCode: exitErr.ExitCode(), Stderr: strings.TrimSpace(stderr.String()), Err: err}
+		}
+		return err
 	}
-	return backupOrKeepOrigin(base, filename, toPath)
+	return nil
 }
 
 func magickResizeOption(size image.Point, mode Mode) string {
@@ -203,7 +235,7 @@ func magickResizeOption(size image.Point, mode Mode) string {
 	return fmt.Sprintf("%dx%d", size.X, size.Y)
 }
 
-func resizeStatic(base string, filename string, to image.Point, mode Mode) (float64, error) {
+func resizeStatic(store BackupStore, run string, base string, filename string, to image.Point, mode Mode) (float64, error) {
 	img, err := loadStaticImage(filename)
 	if err != nil {
 		return 0, err
@@ -213,9 +245,9 @@ func resizeStatic(base string, filename string, to image.Point, mode Mode) (floa
 		return 0, err
 	}
 	if almostOpaque(result) {
-		return writeResizedRGBImage(base, filename, result)
+		return writeResizedRGBImage(store, newRecord(run, to, mode), base, filename, result)
 	}
-	return writeResizedRGBAImage(base, filename, result)
+	return writeResizedRGBAImage(store, newRecord(run, to, mode), base, filename, result)
 }
 
 func almostOpaque(p image.Image) bool {
@@ -2,9 +2,7 @@ package imagetool
 
 import (
 	"ImageZipResize/util/filters"
-	"errors"
-	"image"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
@@ -12,50 +10,18 @@ import (
 
 var rollbackLock sync.Mutex
 
-func Rollback(file string, desire image.Point, mode Mode) error {
-	if !IsOriginBackupPath(file) {
-		return errors.New("rollback not resized origin image")
-	}
-	predictExt, err := predictResizedExt(file, desire, mode)
-	if err != nil {
-		return err
-	}
-	oldPath, err := getOriginOldPath(file)
-	if err != nil {
-		return err
-	}
+// Rollback restores the backup through the store and removes its resized image,
+// resized may be empty when it is gone already.
+func Rollback(logger *slog.Logger, store BackupStore, b Backup, resized string) error {
 	rollbackLock.Lock()
 	defer rollbackLock.Unlock()
-	log.Printf("rollback %s to %s", file, oldPath)
-	if err := os.Rename(file, oldPath); err != nil {
+	logger.Debug("restore backup", "path", b.Location, "archive", b.Archive, "to", b.Origin)
+	if err := store.Restore(b); err != nil {
 		return err
 	}
-	resized := getResizedName(oldPath, predictExt)
-	if filters.PathIsRegularFile(resized) && filepath.Clean(resized) != filepath.Clean(oldPath) {
-		log.Printf("remove resized file %s", resized)
+	if resized != "" && filters.PathIsRegularFile(resized) && filepath.Clean(resized) != filepath.Clean(b.Origin) {
+		logger.Debug("remove resized file", "path", resized)
 		return os.Remove(resized)
 	}
 	return nil
 }
-
-func predictResizedExt(file string, desire image.Point, mode Mode) (string, error) {
-	isGif, err := isGifImage(file)
-	if err != nil {
-		return "", err
-	}
-	if isGif {
-		return extGIF, nil
-	}
-	img, err := loadStaticImage(file)
-	if err != nil {
-		return "", err
-	}
-	resized, err := resize(img, desire, mode)
-	if err != nil {
-		return "", err
-	}
-	if almostOpaque(resized) {
-		return extJPEG, nil
-	}
-	return extPNG, nil
-}
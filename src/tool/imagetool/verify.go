@@ -0,0 +1,200 @@
+package imagetool
+
+import (
+	"ImageZipResize/myerrors"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/webp"
+)
+
+// Verify decodes the whole image, all frames for gif and animated webp. An
+// archive is opened and each of its images is decoded.
+func Verify(filename string) error {
+	if IsSupportedArchiveFilename(filename) {
+		return verifyArchive(filename)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return verifyImageData(filename, data)
+}
+
+func verifyImageData(filename string, data []byte) error {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return decodeError(filename, format, err)
+	}
+	switch {
+	case format == "gif":
+		_, err = gif.DecodeAll(bytes.NewReader(data))
+	case format == "webp" && isAnimatedWebp(data):
+		err = verifyAnimatedWebp(data)
+	default:
+		_, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return decodeError(filename, format, err)
+	}
+	return nil
+}
+
+// verifyArchive decodes the images of an archive, the other entries are only
+// read to check their compression.
+func verifyArchive(filename string) error {
+	reader, err := OpenArchive(filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	images := 0
+	for {
+		entry, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir {
+			continue
+		}
+		data, err := readEntryData(entry)
+		if err != nil {
+			return fmt.Errorf("%s in %s, %w", entry.Name, filename, err)
+		}
+		if !IsSupportedImageFilename(entry.Name) {
+			continue
+		}
+		images++
+		if err := verifyImageData(entry.Name, data); err != nil {
+			return fmt.Errorf("%s in %s, %w", entry.Name, filename, err)
+		}
+	}
+	if images == 0 {
+		return fmt.Errorf("%w, %s", myerrors.ErrNoArchiveImages, filename)
+	}
+	return nil
+}
+
+func isAnimatedWebp(data []byte) bool {
+	return len(data) >= 21 && bytes.Equal(data[12:16], []byte("VP8X")) && data[20]&0x02 != 0
+}
+
+// verifyAnimatedWebp decodes every frame of an animated webp, which the webp
+// decoder does not support, by wrapping the bitstream of each ANMF chunk into a
+// still image of its own.
+func verifyAnimatedWebp(data []byte) error {
+	if len(data) < 30 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return errors.New("webp: invalid header")
+	}
+	canvasWidth, canvasHeight := uint24(data[24:])+1, uint24(data[27:])+1
+	frames := 0
+	err := webpChunks(data[12:], func(id string, payload []byte) error {
+		if id != "ANMF" {
+			return nil
+		}
+		frames++
+		if len(payload) < 16 {
+			return fmt.Errorf("webp: frame %d too short", frames)
+		}
+		x, y := 2*uint24(payload[0:]), 2*uint24(payload[3:])
+		width, height := uint24(payload[6:])+1, uint24(payload[9:])+1
+		if x+width > canvasWidth || y+height > canvasHeight {
+			return fmt.Errorf("webp: frame %d exceeds the canvas", frames)
+		}
+		img, err := webp.Decode(bytes.NewReader(webpFrameImage(payload[16:], width, height)))
+		if err != nil {
+			return fmt.Errorf("webp: frame %d, %w", frames, err)
+		}
+		if size := img.Bounds().Size(); size.X != width || size.Y != height {
+			return fmt.Errorf("webp: frame %d is %dx%d instead of %dx%d", frames, size.X, size.Y, width, height)
+		}
+		return nil
+	})
+	if err == nil && frames == 0 {
+		err = errors.New("webp: animation without frames")
+	}
+	return err
+}
+
+// webpChunks calls fn for every chunk of the data, which must be complete.
+func webpChunks(data []byte, fn func(id string, payload []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return io.ErrUnexpectedEOF
+		}
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size < 0 || size > len(data)-8 {
+			return io.ErrUnexpectedEOF
+		}
+		if err := fn(string(data[:4]), data[8:8+size]); err != nil {
+			return err
+		}
+		data = data[min(len(data), 8+size+size&1):]
+	}
+	return nil
+}
+
+// webpFrameImage wraps the ALPH and VP8 or VP8L chunks of a frame into a webp.
+func webpFrameImage(frame []byte, width, height int) []byte {
+	body := new(bytes.Buffer)
+	body.WriteString("WEBP")
+	if len(frame) >= 4 && string(frame[:4]) == "ALPH" {
+		header := make([]byte, 10)
+		header[0] = 0x10
+		putUint24(header[4:], width-1)
+		putUint24(header[7:], height-1)
+		writeWebpChunk(body, "VP8X", header)
+	}
+	body.Write(frame)
+	out := new(bytes.Buffer)
+	out.WriteString("RIFF")
+	binary.Write(out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+func writeWebpChunk(w *bytes.Buffer, id string, payload []byte) {
+	w.WriteString(id)
+	binary.Write(w, binary.LittleEndian, uint32(len(payload)))
+	w.Write(payload)
+	if len(payload)%2 == 1 {
+		w.WriteByte(0)
+	}
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// VerifyTarget checks the size of a resized image against the magick
+// geometry of its resize, only the geometries limiting the size are checked.
+func VerifyTarget(info ImageInfo, target string) error {
+	geometry := strings.TrimSuffix(target, ">")
+	width, height, found := strings.Cut(geometry, "x")
+	if !found || strings.ContainsAny(geometry, "!^<") {
+		return nil
+	}
+	// rounding may add a pixel
+	if w, err := strconv.Atoi(width); err == nil && info.Width > w+1 {
+		return fmt.Errorf("%w, width %d exceeds %s", myerrors.ErrSizeMismatch, info.Width, target)
+	}
+	if h, err := strconv.Atoi(height); err == nil && info.Height > h+1 {
+		return fmt.Errorf("%w, height %d exceeds %s", myerrors.ErrSizeMismatch, info.Height, target)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package imagetool
+
+import (
+	"ImageZipResize/myerrors"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// animate builds an animated webp showing the still webp images one after
+// another on a canvas of the size of the first.
+func animate(t *testing.T, stills ...[]byte) []byte {
+	t.Helper()
+	conf, err := webp.DecodeConfig(bytes.NewReader(stills[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := new(bytes.Buffer)
+	body.WriteString("WEBP")
+	header := make([]byte, 10)
+	header[0] = 0x12
+	putUint24(header[4:], conf.Width-1)
+	putUint24(header[7:], conf.Height-1)
+	writeWebpChunk(body, "VP8X", header)
+	writeWebpChunk(body, "ANIM", make([]byte, 6))
+	for _, still := range stills {
+		c, err := webp.DecodeConfig(bytes.NewReader(still))
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame := make([]byte, 16)
+		putUint24(frame[6:], c.Width-1)
+		putUint24(frame[9:], c.Height-1)
+		err = webpChunks(still[12:], func(id string, payload []byte) error {
+			if id != "VP8X" {
+				chunk := new(bytes.Buffer)
+				writeWebpChunk(chunk, id, payload)
+				frame = append(frame, chunk.Bytes()...)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeWebpChunk(body, "ANMF", frame)
+	}
+	out := new(bytes.Buffer)
+	out.WriteString("RIFF")
+	binary.Write(out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestVerifyAnimatedWebp(t *testing.T) {
+	lossless := readTestdata(t, "gopher-doc.1bpp.lossless.webp")
+	alpha := readTestdata(t, "yellow_rose.lossy-with-alpha.webp")
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"lossless.webp": animate(t, lossless, lossless),
+		"alpha.webp":    animate(t, alpha, alpha, alpha),
+	} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if !isAnimatedWebp(data) {
+			t.Fatalf("%s is not animated", name)
+		}
+		if err := Verify(file); err != nil {
+			t.Fatalf("Verify(%s) = %v", name, err)
+		}
+		info, err := Inspect(file)
+		if err != nil || info.Frames < 2 {
+			t.Fatalf("Inspect(%s) = %+v, %v", name, info, err)
+		}
+	}
+}
+
+func TestVerifyBrokenAnimatedWebp(t *testing.T) {
+	data := animate(t, readTestdata(t, "gopher-doc.1bpp.lossless.webp"), readTestdata(t, "gopher-doc.1bpp.lossless.webp"))
+	// break the bitstream of the last frame but keep its chunk sizes
+	broken := append([]byte(nil), data...)
+	for i := len(broken) - 40; i < len(broken)-4; i++ {
+		broken[i] = 0xff
+	}
+	cut := data[:len(data)-10]
+	for name, data := range map[string][]byte{"broken.webp": broken, "cut.webp": cut} {
+		file := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(file, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := Verify(file); !errors.Is(err, myerrors.ErrDecode) {
+			t.Errorf("Verify(%s) = %v, want a decode error", name, err)
+		}
+	}
+}
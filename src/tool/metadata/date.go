@@ -0,0 +1,100 @@
+package metadata
+
+import (
+	"ImageZipResize/myerrors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Source is where a capture date is taken from.
+type Source string
+
+const (
+	SourceEXIF      Source = "exif"
+	SourceQuickTime Source = "quicktime"
+	SourceName      Source = "name"
+	SourceModTime   Source = "mtime"
+)
+
+var DefaultSources = []Source{SourceEXIF, SourceQuickTime, SourceName, SourceModTime}
+
+// ParseSources reads a priority order like exif,name,mtime.
+func ParseSources(value string) ([]Source, error) {
+	sources := make([]Source, 0)
+	for _, name := range strings.Split(value, ",") {
+		source := Source(strings.TrimSpace(strings.ToLower(name)))
+		switch source {
+		case SourceEXIF, SourceQuickTime, SourceName, SourceModTime:
+			sources = append(sources, source)
+		default:
+			return nil, fmt.Errorf("unknown date source %q", name)
+		}
+	}
+	return sources, nil
+}
+
+// namePattern finds dates like IMG_20240101_123456, PXL_20240101_123456789,
+// Screenshot_2024-01-01-12-34-56 or 2024-01-01 12.34.56 in file names.
+var namePattern = regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})([-_.]?)(\d{2})([-_.]?)(\d{2})(?:[-_. T]?(\d{2})[-_.:]?(\d{2})[-_.:]?(\d{2})\d{0,3})?(?:\D|$)`)
+
+// ParseName finds a capture date in a file name, in local time.
+func ParseName(name string) (time.Time, bool) {
+	for _, match := range namePattern.FindAllStringSubmatch(name, -1) {
+		// the date separators must agree, so that 2024-0101 is no date
+		if match[2] != match[4] {
+			continue
+		}
+		numbers := make([]int, 0, 6)
+		for _, i := range []int{1, 3, 5, 6, 7, 8} {
+			n, _ := strconv.Atoi(match[i])
+			numbers = append(numbers, n)
+		}
+		t := time.Date(numbers[0], time.Month(numbers[1]), numbers[2], numbers[3], numbers[4], numbers[5], 0, time.Local)
+		// time.Date normalizes overflows like a 13th month, which are no dates
+		if t.Month() == time.Month(numbers[1]) && t.Day() == numbers[2] && t.Hour() == numbers[3] &&
+			t.Minute() == numbers[4] && t.Second() == numbers[5] && !t.After(time.Now().AddDate(0, 0, 1)) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// CaptureTime returns the date of the first source which has one, with the
+// source, m is the metadata of path as Read returns it.
+func CaptureTime(path string, m Metadata, sources []Source) (time.Time, Source, error) {
+	for _, source := range sources {
+		switch source {
+		case SourceEXIF, SourceQuickTime:
+			if isVideo(path) != (source == SourceQuickTime) {
+				continue
+			}
+			if !m.Time.IsZero() {
+				return m.Time, source, nil
+			}
+		case SourceName:
+			if t, ok := ParseName(filepath.Base(path)); ok {
+				return t, source, nil
+			}
+		case SourceModTime:
+			stat, err := os.Stat(path)
+			if err != nil {
+				return time.Time{}, source, err
+			}
+			return stat.ModTime(), source, nil
+		}
+	}
+	return time.Time{}, "", fmt.Errorf("%w, %s", myerrors.ErrNoMetadata, path)
+}
+
+func isVideo(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mov", ".mp4", ".m4v", ".3gp":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package metadata
+
+import (
+	"ImageZipResize/myerrors"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name string
+		want time.Time
+	}{
+		{"IMG_20240101_123456.jpg", time.Date(2024, 1, 1, 12, 34, 56, 0, time.Local)},
+		{"PXL_20230203_040506789.png", time.Date(2023, 2, 3, 4, 5, 6, 0, time.Local)},
+		{"Screenshot_2022-11-12-13-14-15.gif", time.Date(2022, 11, 12, 13, 14, 15, 0, time.Local)},
+		{"2024-01-01 12.34.56.jpg", time.Date(2024, 1, 1, 12, 34, 56, 0, time.Local)},
+		{"scan 1999.12.31.tif", time.Date(1999, 12, 31, 0, 0, 0, 0, time.Local)},
+		{"notes 2024-0101.txt", time.Time{}},
+		{"IMG_20241301_000000.jpg", time.Time{}},
+		{"IMG_20240230.jpg", time.Time{}},
+		{"IMG_1234.jpg", time.Time{}},
+		{"x120240101.jpg", time.Time{}},
+		{"IMG_20990101.jpg", time.Time{}},
+	}
+	for _, test := range tests {
+		got, ok := ParseName(test.name)
+		if !got.Equal(test.want) || ok == test.want.IsZero() {
+			t.Errorf("ParseName(%q) = %v, %v, want %v", test.name, got, ok, test.want)
+		}
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	sources, err := ParseSources("EXIF, name,mtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 3 || sources[0] != SourceEXIF || sources[1] != SourceName || sources[2] != SourceModTime {
+		t.Errorf("sources = %v", sources)
+	}
+	if _, err := ParseSources("exif,ctime"); err == nil {
+		t.Error("ParseSources() of an unknown source succeeded")
+	}
+}
+
+func TestCaptureTime(t *testing.T) {
+	dir := t.TempDir()
+	named := filepath.Join(dir, "IMG_20240101_123456.jpg")
+	plain := filepath.Join(dir, "plain.jpg")
+	exif := filepath.Join(dir, "IMG_20200101_000000.jpg")
+	for path, data := range map[string][]byte{named: {0xff, 0xd8}, plain: {0xff, 0xd8}, exif: sampleJPEG()} {
+		if err := os.WriteFile(path, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modTime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.Local)
+	if err := os.Chtimes(plain, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		sources []Source
+		want    time.Time
+		source  Source
+	}{
+		{exif, DefaultSources, sampleTime, SourceEXIF},
+		{exif, []Source{SourceName, SourceEXIF}, time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local), SourceName},
+		{named, DefaultSources, time.Date(2024, 1, 1, 12, 34, 56, 0, time.Local), SourceName},
+		{plain, DefaultSources, modTime, SourceModTime},
+		// QuickTime is only read from videos
+		{exif, []Source{SourceQuickTime, SourceModTime}, time.Time{}, SourceModTime},
+	}
+	for _, test := range tests {
+		m, _ := Read(test.path)
+		got, source, err := CaptureTime(test.path, m, test.sources)
+		if err != nil {
+			t.Errorf("CaptureTime(%s, %v): %v", filepath.Base(test.path), test.sources, err)
+			continue
+		}
+		if source != test.source || (!test.want.IsZero() && !got.Equal(test.want)) {
+			t.Errorf("CaptureTime(%s, %v) = %v, %s, want %v, %s", filepath.Base(test.path), test.sources, got, source, test.want, test.source)
+		}
+	}
+	if _, _, err := CaptureTime(plain, Metadata{}, []Source{SourceEXIF, SourceName}); !errors.Is(err, myerrors.ErrNoMetadata) {
+		t.Errorf("CaptureTime() without date error = %v, want %v", err, myerrors.ErrNoMetadata)
+	}
+}
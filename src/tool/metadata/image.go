@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"ImageZipResize/myerrors"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxEXIFSize bounds the EXIF read into memory, segments of JPEG are smaller anyway.
+const maxEXIFSize = 1 << 20
+
+// readJPEG finds the Exif APP1 segment before the image data.
+func readJPEG(file *os.File) (Metadata, error) {
+	r := bufio.NewReader(file)
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || header != [2]byte{0xff, 0xd8} {
+		return Metadata{}, fmt.Errorf("%w, not a JPEG", myerrors.ErrNoMetadata)
+	}
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:2]); err != nil {
+			return Metadata{}, err
+		}
+		if marker[0] != 0xff {
+			return Metadata{}, fmt.Errorf("%w, invalid JPEG marker", myerrors.ErrNoMetadata)
+		}
+		if marker[1] == 0xff {
+			r.UnreadByte()
+			continue
+		}
+		// start of scan or end of image, no metadata follows
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return Metadata{}, fmt.Errorf("%w, no EXIF segment", myerrors.ErrNoMetadata)
+		}
+		if _, err := io.ReadFull(r, marker[2:]); err != nil {
+			return Metadata{}, err
+		}
+		size := int64(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return Metadata{}, fmt.Errorf("%w, invalid JPEG segment", myerrors.ErrNoMetadata)
+		}
+		if marker[1] != 0xe1 {
+			if _, err := r.Discard(int(size)); err != nil {
+				return Metadata{}, err
+			}
+			continue
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return Metadata{}, err
+		}
+		if bytes.HasPrefix(data, []byte("Exif\x00\x00")) {
+			return parseEXIF(data)
+		}
+	}
+}
+
+// readPNG finds the eXIf chunk.
+func readPNG(file *os.File) (Metadata, error) {
+	var signature [8]byte
+	if _, err := io.ReadFull(file, signature[:]); err != nil || string(signature[:]) != "\x89PNG\r\n\x1a\n" {
+		return Metadata{}, fmt.Errorf("%w, not a PNG", myerrors.ErrNoMetadata)
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(file, header[:]); err != nil {
+			return Metadata{}, fmt.Errorf("%w, no eXIf chunk", myerrors.ErrNoMetadata)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		switch string(header[4:]) {
+		case "eXIf":
+			data, err := readChunk(file, size)
+			if err != nil {
+				return Metadata{}, err
+			}
+			return parseEXIF(data)
+		case "IEND":
+			return Metadata{}, fmt.Errorf("%w, no eXIf chunk", myerrors.ErrNoMetadata)
+		}
+		// the data and its CRC
+		if _, err := file.Seek(size+4, io.SeekCurrent); err != nil {
+			return Metadata{}, err
+		}
+	}
+}
+
+// readWebP finds the EXIF chunk of an extended WebP.
+func readWebP(file *os.File) (Metadata, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(file, header[:]); err != nil || string(header[:4]) != "RIFF" || string(header[8:]) != "WEBP" {
+		return Metadata{}, fmt.Errorf("%w, not a WebP", myerrors.ErrNoMetadata)
+	}
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(file, chunk[:]); err != nil {
+			return Metadata{}, fmt.Errorf("%w, no EXIF chunk", myerrors.ErrNoMetadata)
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		if string(chunk[:4]) == "EXIF" {
+			data, err := readChunk(file, size)
+			if err != nil {
+				return Metadata{}, err
+			}
+			return parseEXIF(data)
+		}
+		// chunks are padded to an even size
+		if _, err := file.Seek(size+size%2, io.SeekCurrent); err != nil {
+			return Metadata{}, err
+		}
+	}
+}
+
+func readChunk(r io.Reader, size int64) ([]byte, error) {
+	if size > maxEXIFSize {
+		return nil, fmt.Errorf("%w, EXIF of %d bytes is too large", myerrors.ErrNoMetadata, size)
+	}
+	data := make([]byte, size)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
@@ -0,0 +1,312 @@
+package metadata
+
+import (
+	"ImageZipResize/myerrors"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// box is an ISO base media box, offset and size are of its payload.
+type box struct {
+	typ    string
+	offset int64
+	size   int64
+}
+
+// readBoxes visits the boxes between start and end, a negative end is the end of the file.
+func readBoxes(file *os.File, start, end int64, visit func(b box) error) error {
+	if end < 0 {
+		stat, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		end = stat.Size()
+	}
+	for offset := start; offset+8 <= end; {
+		var header [16]byte
+		if _, err := file.ReadAt(header[:8], offset); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		b := box{typ: string(header[4:8]), offset: offset + 8}
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := file.ReadAt(header[8:], offset+8); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			b.offset += 8
+		}
+		if size < b.offset-offset || size > end-offset {
+			return fmt.Errorf("%w, invalid %q box", myerrors.ErrNoMetadata, b.typ)
+		}
+		b.size = offset + size - b.offset
+		if err := visit(b); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
+
+func findBox(file *os.File, start, end int64, path ...string) (box, bool, error) {
+	var found box
+	var ok bool
+	err := readBoxes(file, start, end, func(b box) error {
+		if ok || b.typ != path[0] {
+			return nil
+		}
+		if len(path) == 1 {
+			found, ok = b, true
+			return nil
+		}
+		var err error
+		found, ok, err = findBox(file, b.offset, b.offset+b.size, path[1:]...)
+		return err
+	})
+	return found, ok, err
+}
+
+func readBox(file *os.File, b box) ([]byte, error) {
+	if b.size > maxEXIFSize {
+		return nil, fmt.Errorf("%w, %q box of %d bytes is too large", myerrors.ErrNoMetadata, b.typ, b.size)
+	}
+	data := make([]byte, b.size)
+	_, err := file.ReadAt(data, b.offset)
+	return data, err
+}
+
+// readHEIF finds the Exif item of a HEIF image through its item info and location.
+func readHEIF(file *os.File) (Metadata, error) {
+	meta, ok, err := findBox(file, 0, -1, "meta")
+	if err != nil || !ok {
+		return Metadata{}, fmt.Errorf("%w, no meta box", myerrors.ErrNoMetadata)
+	}
+	// meta is a full box, skip its version and flags
+	start, end := meta.offset+4, meta.offset+meta.size
+	iinf, ok, err := findBox(file, start, end, "iinf")
+	if err != nil || !ok {
+		return Metadata{}, fmt.Errorf("%w, no item info", myerrors.ErrNoMetadata)
+	}
+	id, ok, err := findExifItem(file, iinf)
+	if err != nil || !ok {
+		return Metadata{}, fmt.Errorf("%w, no Exif item", myerrors.ErrNoMetadata)
+	}
+	iloc, ok, err := findBox(file, start, end, "iloc")
+	if err != nil || !ok {
+		return Metadata{}, fmt.Errorf("%w, no item location", myerrors.ErrNoMetadata)
+	}
+	data, err := readBox(file, iloc)
+	if err != nil {
+		return Metadata{}, err
+	}
+	offset, length, ok := locateItem(data, id)
+	if !ok || length < 4 {
+		return Metadata{}, fmt.Errorf("%w, Exif item not located", myerrors.ErrNoMetadata)
+	}
+	exif, err := readBox(file, box{typ: "Exif", offset: offset, size: length})
+	if err != nil {
+		return Metadata{}, err
+	}
+	// the item starts with the offset of the TIFF header after this field
+	skip := uint64(binary.BigEndian.Uint32(exif)) + 4
+	if skip > uint64(len(exif)) {
+		return Metadata{}, fmt.Errorf("%w, invalid Exif item", myerrors.ErrNoMetadata)
+	}
+	return parseEXIF(exif[skip:])
+}
+
+func findExifItem(file *os.File, iinf box) (uint32, bool, error) {
+	var header [6]byte
+	if _, err := file.ReadAt(header[:], iinf.offset); err != nil {
+		return 0, false, err
+	}
+	start := iinf.offset + 6
+	if header[0] > 0 {
+		start += 2
+	}
+	var id uint32
+	var ok bool
+	err := readBoxes(file, start, iinf.offset+iinf.size, func(b box) error {
+		if ok || b.typ != "infe" || b.size < 12 {
+			return nil
+		}
+		var infe [12]byte
+		if _, err := file.ReadAt(infe[:], b.offset); err != nil {
+			return err
+		}
+		switch infe[0] {
+		case 2:
+			id, ok = uint32(binary.BigEndian.Uint16(infe[4:])), string(infe[8:12]) == "Exif"
+		case 3:
+			if b.size >= 14 {
+				var typ [4]byte
+				if _, err := file.ReadAt(typ[:], b.offset+10); err != nil {
+					return err
+				}
+				id, ok = binary.BigEndian.Uint32(infe[4:]), string(typ[:]) == "Exif"
+			}
+		}
+		return nil
+	})
+	return id, ok, err
+}
+
+// locateItem reads the file offset and length of the first extent of an item
+// from the payload of an iloc box.
+func locateItem(data []byte, id uint32) (int64, int64, bool) {
+	if len(data) < 8 {
+		return 0, 0, false
+	}
+	version := data[0]
+	offsetSize, lengthSize := int(data[4]>>4), int(data[4]&0xf)
+	baseSize, indexSize := int(data[5]>>4), 0
+	if version == 1 || version == 2 {
+		indexSize = int(data[5] & 0xf)
+	}
+	pos := 6
+	read := func(size int) (uint64, bool) {
+		if pos+size > len(data) {
+			return 0, false
+		}
+		var v uint64
+		for _, b := range data[pos : pos+size] {
+			v = v<<8 | uint64(b)
+		}
+		pos += size
+		return v, true
+	}
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count, ok := read(idSize)
+	for i := uint64(0); ok && i < count; i++ {
+		var itemID, method, base, extents uint64
+		itemID, ok = read(idSize)
+		if version == 1 || version == 2 {
+			method, _ = read(2)
+			method &= 0xf
+		}
+		read(2)
+		base, _ = read(baseSize)
+		extents, ok = read(2)
+		for j := uint64(0); ok && j < extents; j++ {
+			read(indexSize)
+			var offset, length uint64
+			offset, _ = read(offsetSize)
+			length, ok = read(lengthSize)
+			if ok && j == 0 && uint32(itemID) == id && method == 0 {
+				return int64(base + offset), int64(length), true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// quickTimeEpoch is the origin of the times of QuickTime movie headers.
+var quickTimeEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// readQuickTime prefers the creation date of Apple metadata, which keeps the
+// time zone, to the creation time of the movie header.
+func readQuickTime(file *os.File) (Metadata, error) {
+	moov, ok, err := findBox(file, 0, -1, "moov")
+	if err != nil || !ok {
+		return Metadata{}, fmt.Errorf("%w, no movie box", myerrors.ErrNoMetadata)
+	}
+	m := readAppleMetadata(file, moov)
+	if !m.Time.IsZero() {
+		return m, nil
+	}
+	mvhd, ok, err := findBox(file, moov.offset, moov.offset+moov.size, "mvhd")
+	if err != nil || !ok {
+		return m, fmt.Errorf("%w, no movie header", myerrors.ErrNoMetadata)
+	}
+	var header [12]byte
+	if _, err := file.ReadAt(header[:], mvhd.offset); err != nil {
+		return m, err
+	}
+	var seconds uint64
+	if header[0] == 1 {
+		seconds = binary.BigEndian.Uint64(header[4:])
+	} else {
+		seconds = uint64(binary.BigEndian.Uint32(header[4:]))
+	}
+	// many encoders leave the creation time unset
+	if seconds > 0 {
+		m.Time = quickTimeEpoch.Add(time.Duration(seconds) * time.Second).Local()
+	}
+	return m, nil
+}
+
+// readAppleMetadata reads the creation date, make and model from the keys
+// and the item list of the meta box of a movie.
+func readAppleMetadata(file *os.File, moov box) Metadata {
+	var m Metadata
+	meta, ok, err := findBox(file, moov.offset, moov.offset+moov.size, "meta")
+	if err != nil || !ok {
+		return m
+	}
+	start, end := meta.offset, meta.offset+meta.size
+	// meta of QuickTime is a plain box and of MP4 a full box
+	var version [4]byte
+	if _, err := file.ReadAt(version[:], start); err == nil && version == [4]byte{} {
+		start += 4
+	}
+	keysBox, ok, err := findBox(file, start, end, "keys")
+	if err != nil || !ok {
+		return m
+	}
+	data, err := readBox(file, keysBox)
+	if err != nil || len(data) < 8 {
+		return m
+	}
+	keys := make([]string, 0)
+	for pos := 8; pos+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		if size < 8 || pos+size > len(data) {
+			break
+		}
+		keys = append(keys, string(data[pos+8:pos+size]))
+		pos += size
+	}
+	ilst, ok, err := findBox(file, start, end, "ilst")
+	if err != nil || !ok {
+		return m
+	}
+	readBoxes(file, ilst.offset, ilst.offset+ilst.size, func(item box) error {
+		index := int(binary.BigEndian.Uint32([]byte(item.typ)))
+		if index < 1 || index > len(keys) {
+			return nil
+		}
+		value, ok, err := findBox(file, item.offset, item.offset+item.size, "data")
+		if err != nil || !ok || value.size < 8 {
+			return nil
+		}
+		data, err := readBox(file, box{typ: "data", offset: value.offset + 8, size: value.size - 8})
+		if err != nil {
+			return nil
+		}
+		text := strings.TrimSpace(string(data))
+		switch keys[index-1] {
+		case "com.apple.quicktime.creationdate":
+			for _, layout := range []string{"2006-01-02T15:04:05-0700", time.RFC3339} {
+				if t, err := time.Parse(layout, text); err == nil {
+					m.Time = t.Local()
+					break
+				}
+			}
+		case "com.apple.quicktime.make":
+			m.Make = text
+		case "com.apple.quicktime.model":
+			m.Model = text
+		}
+		return nil
+	})
+	return m
+}
@@ -0,0 +1,123 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func isoBox(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	data := binary.BigEndian.AppendUint32(nil, uint32(size))
+	data = append(data, typ...)
+	for _, p := range payloads {
+		data = append(data, p...)
+	}
+	return data
+}
+
+// sampleHEIF holds the sample EXIF as an item of the media data, located by
+// the iloc box of the meta box.
+func sampleHEIF() []byte {
+	ftyp := isoBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	infe := isoBox("infe", []byte{2, 0, 0, 0, 0, 7, 0, 0}, []byte("Exif\x00"))
+	iinf := isoBox("iinf", []byte{0, 0, 0, 0, 0, 1}, infe)
+	item := append([]byte{0, 0, 0, 0}, sampleEXIF(binary.BigEndian)...)
+	meta := func(offset int) []byte {
+		iloc := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1, 0, 7, 0, 0, 0, 1}
+		iloc = binary.BigEndian.AppendUint32(iloc, uint32(offset))
+		iloc = binary.BigEndian.AppendUint32(iloc, uint32(len(item)))
+		return isoBox("meta", []byte{0, 0, 0, 0}, isoBox("hdlr", make([]byte, 24)), iinf, isoBox("iloc", iloc))
+	}
+	offset := len(ftyp) + len(meta(0)) + 8
+	return append(append(ftyp, meta(offset)...), isoBox("mdat", item)...)
+}
+
+func movieHeader(created time.Time) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[4:], uint32(created.Sub(quickTimeEpoch)/time.Second))
+	return isoBox("mvhd", mvhd)
+}
+
+func sampleQuickTime() []byte {
+	return append(isoBox("ftyp", []byte("qt  \x00\x00\x00\x00")), isoBox("moov", movieHeader(sampleTime))...)
+}
+
+// sampleAppleQuickTime has the creation date in Apple metadata, in another
+// zone and with another time than the movie header.
+func sampleAppleQuickTime() []byte {
+	keys := []byte{0, 0, 0, 0, 0, 0, 0, 3}
+	for _, key := range []string{"com.apple.quicktime.make", "com.apple.quicktime.creationdate", "com.apple.quicktime.model"} {
+		keys = append(keys, isoBox("mdta", []byte(key))...)
+	}
+	value := func(index uint32, text string) []byte {
+		typ := string(binary.BigEndian.AppendUint32(nil, index))
+		return isoBox(typ, isoBox("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte(text)))
+	}
+	ilst := isoBox("ilst", value(1, "Apple"), value(2, "2024-03-05T14:15:16+0200"), value(3, "iPhone 15"))
+	meta := isoBox("meta", isoBox("hdlr", make([]byte, 24)), isoBox("keys", keys), ilst)
+	moov := isoBox("moov", movieHeader(time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)), meta)
+	return append(isoBox("ftyp", []byte("qt  \x00\x00\x00\x00")), moov...)
+}
+
+func TestReadQuickTime(t *testing.T) {
+	for name, test := range map[string]struct {
+		data   []byte
+		camera string
+	}{
+		"a.mov": {sampleQuickTime(), ""},
+		"b.mp4": {sampleAppleQuickTime(), "Apple iPhone 15"},
+	} {
+		m, err := Read(writeSample(t, name, test.data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !m.Time.Equal(sampleTime) || m.Camera() != test.camera {
+			t.Errorf("%s: got %v %q, want %v %q", name, m.Time, m.Camera(), sampleTime, test.camera)
+		}
+	}
+}
+
+func TestReadBoxesOverflow(t *testing.T) {
+	// an iloc box with a 64-bit size which overflows the offset past it
+	iloc := append(binary.BigEndian.AppendUint32(nil, 1), "iloc"...)
+	iloc = binary.BigEndian.AppendUint64(iloc, 1<<63-1)
+	iloc = append(iloc, make([]byte, 16)...)
+	infe := isoBox("infe", []byte{2, 0, 0, 0, 0, 7, 0, 0}, []byte("Exif\x00"))
+	meta := isoBox("meta", []byte{0, 0, 0, 0}, isoBox("iinf", []byte{0, 0, 0, 0, 0, 1}, infe), iloc)
+	data := append(isoBox("ftyp", []byte("heic\x00\x00\x00\x00")), meta...)
+	if m, err := Read(writeSample(t, "a.heic", data)); err == nil {
+		t.Errorf("read %+v from an invalid box", m)
+	}
+}
+
+func TestLocateItem(t *testing.T) {
+	// version 1 with a construction method, base offsets and extent indexes
+	iloc := []byte{1, 0, 0, 0, 0x44, 0x44, 0, 2}
+	for _, item := range [][5]uint32{{3, 1, 16, 1, 2}, {5, 0, 256, 4, 9}} {
+		iloc = binary.BigEndian.AppendUint16(iloc, uint16(item[0]))
+		iloc = binary.BigEndian.AppendUint16(iloc, uint16(item[1]))
+		iloc = append(iloc, 0, 0)
+		iloc = binary.BigEndian.AppendUint32(iloc, item[2])
+		iloc = append(iloc, 0, 1, 0, 0, 0, 0)
+		iloc = binary.BigEndian.AppendUint32(iloc, item[3])
+		iloc = binary.BigEndian.AppendUint32(iloc, item[4])
+	}
+	offset, length, ok := locateItem(iloc, 5)
+	if !ok || offset != 256+4 || length != 9 {
+		t.Errorf("locateItem(5) = %d, %d, %v, want 260, 9, true", offset, length, ok)
+	}
+	// item 3 is constructed from another item, not located in the file
+	for _, id := range []uint32{3, 7} {
+		if _, _, ok := locateItem(iloc, id); ok {
+			t.Errorf("located item %d", id)
+		}
+	}
+	for n := range iloc {
+		locateItem(iloc[:n], 5)
+	}
+}
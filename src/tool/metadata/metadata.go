@@ -0,0 +1,61 @@
+package metadata
+
+import (
+	"ImageZipResize/myerrors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Metadata is what is known about the capture of an image or a video.
+type Metadata struct {
+	Time  time.Time
+	Make  string
+	Model string
+}
+
+// Camera is the model, prefixed by the make unless the model already names it.
+func (m Metadata) Camera() string {
+	if m.Make == "" || strings.HasPrefix(strings.ToLower(m.Model), strings.ToLower(m.Make)) {
+		return m.Model
+	}
+	if m.Model == "" {
+		return m.Make
+	}
+	return m.Make + " " + m.Model
+}
+
+// Read reads the embedded metadata of a file by its extension, the EXIF of
+// JPEG, PNG, WebP and HEIF images or the QuickTime metadata of videos.
+func Read(path string) (Metadata, error) {
+	var read func(file *os.File) (Metadata, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		read = readJPEG
+	case ".png":
+		read = readPNG
+	case ".webp":
+		read = readWebP
+	case ".heic", ".heif", ".avif":
+		read = readHEIF
+	case ".mov", ".mp4", ".m4v", ".3gp":
+		read = readQuickTime
+	default:
+		return Metadata{}, fmt.Errorf("%w, unsupported file %s", myerrors.ErrNoMetadata, path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer file.Close()
+	m, err := read(file)
+	if err != nil {
+		return m, fmt.Errorf("%w, %s", err, path)
+	}
+	if m.Time.IsZero() {
+		return m, fmt.Errorf("%w, %s", myerrors.ErrNoMetadata, path)
+	}
+	return m, nil
+}
@@ -0,0 +1,135 @@
+package metadata
+
+import (
+	"ImageZipResize/myerrors"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var sampleTime = time.Date(2024, 3, 5, 12, 15, 16, 0, time.UTC)
+
+func writeSample(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sampleJPEG() []byte {
+	exif := append([]byte("Exif\x00\x00"), sampleEXIF(binary.BigEndian)...)
+	data := []byte{0xff, 0xd8}
+	// an APP0 segment before the Exif one, and a fill byte
+	data = append(data, 0xff, 0xe0, 0, 7, 'J', 'F', 'I', 'F', 0)
+	data = append(data, 0xff, 0xff, 0xe1)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(exif)+2))
+	data = append(data, exif...)
+	return append(data, 0xff, 0xda, 0, 2, 0xff, 0xd9)
+}
+
+func samplePNG() []byte {
+	chunk := func(data []byte, typ string, payload []byte) []byte {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(payload)))
+		data = append(data, typ...)
+		data = append(data, payload...)
+		return append(data, 0, 0, 0, 0)
+	}
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = chunk(data, "IHDR", make([]byte, 13))
+	data = chunk(data, "eXIf", sampleEXIF(binary.LittleEndian))
+	return chunk(data, "IEND", nil)
+}
+
+func sampleWebP() []byte {
+	chunk := func(data []byte, typ string, payload []byte) []byte {
+		data = append(data, typ...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(payload)))
+		data = append(data, payload...)
+		if len(payload)%2 == 1 {
+			data = append(data, 0)
+		}
+		return data
+	}
+	data := chunk(nil, "VP8X", make([]byte, 10))
+	data = chunk(data, "ICCP", make([]byte, 3))
+	data = chunk(data, "EXIF", sampleEXIF(binary.LittleEndian))
+	header := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(data)+4))...)
+	return append(append(header, "WEBP"...), data...)
+}
+
+func TestRead(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"a.jpg":  sampleJPEG(),
+		"a.PNG":  samplePNG(),
+		"a.webp": sampleWebP(),
+		"a.heic": sampleHEIF(),
+	} {
+		m, err := Read(writeSample(t, name, data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !m.Time.Equal(sampleTime) || m.Camera() != "Canon EOS R5" {
+			t.Errorf("%s: got %v %q", name, m.Time, m.Camera())
+		}
+	}
+}
+
+func TestReadWithoutEXIF(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"a.jpg":  {0xff, 0xd8, 0xff, 0xda, 0, 2},
+		"b.jpg":  []byte("GIF89a"),
+		"a.png":  []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x00IEND\x00\x00\x00\x00"),
+		"a.webp": []byte("RIFF\x04\x00\x00\x00WEBP"),
+		"a.gif":  []byte("GIF89a"),
+	} {
+		if _, err := Read(writeSample(t, name, data)); !errors.Is(err, myerrors.ErrNoMetadata) {
+			t.Errorf("%s: error = %v, want %v", name, err, myerrors.ErrNoMetadata)
+		}
+	}
+}
+
+// TestReadTruncated reads every prefix of the samples, which must fail
+// without panicking or read the full metadata.
+func TestReadTruncated(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"a.jpg":  sampleJPEG(),
+		"a.png":  samplePNG(),
+		"a.webp": sampleWebP(),
+		"a.heic": sampleHEIF(),
+		"a.mov":  sampleQuickTime(),
+		"b.mov":  sampleAppleQuickTime(),
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		for n := 0; n < len(data); n++ {
+			if err := os.WriteFile(path, data[:n], 0666); err != nil {
+				t.Fatal(err)
+			}
+			if m, err := Read(path); err == nil && m.Time.IsZero() {
+				t.Errorf("%s of %d bytes: no error without time", name, n)
+			}
+		}
+	}
+}
+
+func TestCamera(t *testing.T) {
+	tests := []struct {
+		m    Metadata
+		want string
+	}{
+		{Metadata{Make: "Canon", Model: "Canon EOS R5"}, "Canon EOS R5"},
+		{Metadata{Make: "Apple", Model: "iPhone 15"}, "Apple iPhone 15"},
+		{Metadata{Make: "Apple"}, "Apple"},
+		{Metadata{Model: "X100V"}, "X100V"},
+	}
+	for _, test := range tests {
+		if got := test.m.Camera(); got != test.want {
+			t.Errorf("%+v.Camera() = %q, want %q", test.m, got, test.want)
+		}
+	}
+}
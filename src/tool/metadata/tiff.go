@@ -0,0 +1,121 @@
+package metadata
+
+import (
+	"ImageZipResize/myerrors"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+	tagCreateDate       = 0x9004
+	tagOffsetOriginal   = 0x9011
+	tagOffsetCreate     = 0x9012
+
+	typeASCII = 2
+	typeLong  = 4
+	typeIFD   = 13
+)
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// parseEXIF reads the capture date and camera from EXIF data, which is a TIFF
+// structure optionally preceded by the Exif header of JPEG.
+func parseEXIF(data []byte) (Metadata, error) {
+	data = bytes.TrimPrefix(data, []byte("Exif\x00\x00"))
+	if len(data) < 8 {
+		return Metadata{}, fmt.Errorf("%w, truncated EXIF", myerrors.ErrNoMetadata)
+	}
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte("MM\x00*")):
+		order = binary.BigEndian
+	default:
+		return Metadata{}, fmt.Errorf("%w, invalid EXIF header", myerrors.ErrNoMetadata)
+	}
+	ifd0, err := readIFD(data, order, order.Uint32(data[4:8]))
+	if err != nil {
+		return Metadata{}, err
+	}
+	m := Metadata{Make: asciiValue(ifd0[tagMake]), Model: asciiValue(ifd0[tagModel])}
+	pointer, ok := ifd0[tagExifIFD]
+	if !ok || len(pointer.value) < 4 {
+		return m, nil
+	}
+	exif, err := readIFD(data, order, order.Uint32(pointer.value))
+	if err != nil {
+		return m, err
+	}
+	for _, tags := range [][2]uint16{{tagDateTimeOriginal, tagOffsetOriginal}, {tagCreateDate, tagOffsetCreate}} {
+		if t, ok := parseEXIFTime(asciiValue(exif[tags[0]]), asciiValue(exif[tags[1]])); ok {
+			m.Time = t
+			break
+		}
+	}
+	return m, nil
+}
+
+func readIFD(data []byte, order binary.ByteOrder, offset uint32) (map[uint16]ifdEntry, error) {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return nil, fmt.Errorf("%w, IFD out of range", myerrors.ErrNoMetadata)
+	}
+	count := int(order.Uint16(data[offset:]))
+	entries := make(map[uint16]ifdEntry, count)
+	for i := 0; i < count; i++ {
+		start := uint64(offset) + 2 + uint64(i)*12
+		if start+12 > uint64(len(data)) {
+			break
+		}
+		raw := data[start : start+12]
+		e := ifdEntry{typ: order.Uint16(raw[2:]), count: order.Uint32(raw[4:])}
+		size := uint64(e.count)
+		if e.typ == typeLong || e.typ == typeIFD {
+			size *= 4
+		} else if e.typ != typeASCII {
+			continue
+		}
+		if size <= 4 {
+			e.value = raw[8 : 8+size]
+		} else if at := uint64(order.Uint32(raw[8:])); at+size <= uint64(len(data)) {
+			e.value = data[at : at+size]
+		} else {
+			continue
+		}
+		entries[order.Uint16(raw)] = e
+	}
+	return entries, nil
+}
+
+func asciiValue(e ifdEntry) string {
+	if e.typ != typeASCII {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+// parseEXIFTime reads a date like 2006:01:02 15:04:05, in the offset like
+// +01:00 when there is one and local time otherwise.
+func parseEXIFTime(value, offset string) (time.Time, bool) {
+	if value == "" || strings.HasPrefix(value, "0000") {
+		return time.Time{}, false
+	}
+	if offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset); err == nil {
+			return t.Local(), true
+		}
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", value, time.Local)
+	return t, err == nil
+}
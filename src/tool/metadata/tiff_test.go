@@ -0,0 +1,130 @@
+package metadata
+
+import (
+	"ImageZipResize/myerrors"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type tiffTag struct {
+	tag   uint16
+	typ   uint16
+	value []byte
+}
+
+func asciiTag(tag uint16, value string) tiffTag {
+	return tiffTag{tag: tag, typ: typeASCII, value: []byte(value + "\x00")}
+}
+
+// buildEXIF writes a TIFF structure with the tags of IFD0 and of the Exif IFD
+// it points to, the values which do not fit an entry follow both IFDs.
+func buildEXIF(order byteOrder, ifd0, exif []tiffTag) []byte {
+	data := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(data, "II*\x00")
+	} else {
+		copy(data, "MM\x00*")
+	}
+	order.PutUint32(data[4:], 8)
+	ifdSize := func(n int) int { return 2 + 12*n + 4 }
+	exifOffset := 8 + ifdSize(len(ifd0)+1)
+	values := exifOffset + ifdSize(len(exif))
+	var area []byte
+	writeIFD := func(tags []tiffTag) {
+		data = order.AppendUint16(data, uint16(len(tags)))
+		for _, t := range tags {
+			count := len(t.value)
+			if t.typ == typeLong {
+				count /= 4
+			}
+			data = order.AppendUint16(data, t.tag)
+			data = order.AppendUint16(data, t.typ)
+			data = order.AppendUint32(data, uint32(count))
+			if len(t.value) <= 4 {
+				data = append(data, append(t.value, make([]byte, 4-len(t.value))...)...)
+				continue
+			}
+			data = order.AppendUint32(data, uint32(values+len(area)))
+			area = append(area, t.value...)
+		}
+		data = order.AppendUint32(data, 0)
+	}
+	pointer := order.AppendUint32(nil, uint32(exifOffset))
+	writeIFD(append(ifd0, tiffTag{tag: tagExifIFD, typ: typeLong, value: pointer}))
+	writeIFD(exif)
+	return append(data, area...)
+}
+
+func sampleEXIF(order byteOrder) []byte {
+	return buildEXIF(order,
+		[]tiffTag{asciiTag(tagMake, "Canon"), asciiTag(tagModel, "Canon EOS R5")},
+		[]tiffTag{asciiTag(tagDateTimeOriginal, "2024:03:05 14:15:16"), asciiTag(tagOffsetOriginal, "+02:00")},
+	)
+}
+
+func TestParseEXIF(t *testing.T) {
+	want := time.Date(2024, 3, 5, 12, 15, 16, 0, time.UTC)
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		m, err := parseEXIF(append([]byte("Exif\x00\x00"), sampleEXIF(order)...))
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		if !m.Time.Equal(want) || m.Camera() != "Canon EOS R5" {
+			t.Errorf("%v: got %v %q, want %v %q", order, m.Time, m.Camera(), want, "Canon EOS R5")
+		}
+	}
+}
+
+func TestParseEXIFCreateDate(t *testing.T) {
+	data := buildEXIF(binary.LittleEndian, nil, []tiffTag{
+		asciiTag(tagDateTimeOriginal, "0000:00:00 00:00:00"),
+		asciiTag(tagCreateDate, "2020:01:02 03:04:05"),
+	})
+	m, err := parseEXIF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local); !m.Time.Equal(want) {
+		t.Errorf("time = %v, want %v", m.Time, want)
+	}
+}
+
+func TestParseEXIFTruncated(t *testing.T) {
+	data := sampleEXIF(binary.BigEndian)
+	for n := 0; n < len(data); n++ {
+		// a copy, so that nothing is read past the end
+		_, err := parseEXIF(append([]byte(nil), data[:n]...))
+		if n < 8 && !errors.Is(err, myerrors.ErrNoMetadata) {
+			t.Errorf("%d bytes: error = %v, want %v", n, err, myerrors.ErrNoMetadata)
+		}
+	}
+}
+
+func TestParseEXIFOutOfRange(t *testing.T) {
+	data := sampleEXIF(binary.LittleEndian)
+	corrupt := func(at int, value uint32) []byte {
+		c := append([]byte(nil), data...)
+		binary.LittleEndian.PutUint32(c[at:], value)
+		return c
+	}
+
+	if _, err := parseEXIF(corrupt(4, 0xfffffff0)); !errors.Is(err, myerrors.ErrNoMetadata) {
+		t.Errorf("IFD0 out of range: error = %v, want %v", err, myerrors.ErrNoMetadata)
+	}
+	// the value of the make is dropped, the other tags are still read
+	m, err := parseEXIF(corrupt(8+2+8, 0xfffffff0))
+	if err != nil || m.Make != "" || m.Model != "Canon EOS R5" || m.Time.IsZero() {
+		t.Errorf("make out of range: got %+v, %v", m, err)
+	}
+	m, err = parseEXIF(corrupt(8+2+2*12+8, uint32(len(data))))
+	if !errors.Is(err, myerrors.ErrNoMetadata) || !m.Time.IsZero() || m.Make != "Canon" {
+		t.Errorf("Exif IFD out of range: got %+v, %v", m, err)
+	}
+}
@@ -0,0 +1,164 @@
+package rename
+
+import (
+	"ImageZipResize/util/fileutil"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// journalName is the file at the root of a rename listing every move, written
+// before the moves are made so that they can be undone.
+const journalName = ".rename.journal.jsonl"
+
+type journalEntry struct {
+	Run  string    `json:"run"`
+	Time time.Time `json:"time"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+}
+
+func IsJournalPath(file string) bool {
+	return filepath.Base(file) == journalName
+}
+
+func appendJournal(root, run string, moves []Move) error {
+	file, err := os.OpenFile(filepath.Join(root, journalName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	now := time.Now()
+	for _, m := range moves {
+		from, err := filepath.Rel(root, m.From)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		to, err := filepath.Rel(root, m.To)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		data, err := json.Marshal(journalEntry{Run: run, Time: now, From: filepath.ToSlash(from), To: filepath.ToSlash(to)})
+		if err != nil {
+			file.Close()
+			return err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readJournal(root string) ([]journalEntry, error) {
+	file, err := os.Open(filepath.Join(root, journalName))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := make([]journalEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("journal %s, %w", file.Name(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// PlanUndo returns the moves reverting the latest run recorded at root, in
+// reverse order, leaving out the moves which were never made.
+func PlanUndo(root string) (string, []Move, error) {
+	entries, err := readJournal(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil, fmt.Errorf("nothing to undo in %s, %w", root, err)
+	}
+	if err != nil || len(entries) == 0 {
+		return "", nil, err
+	}
+	run := entries[len(entries)-1].Run
+	moves := make([]Move, 0)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Run != run {
+			continue
+		}
+		m := Move{From: filepath.Join(root, filepath.FromSlash(e.To)), To: filepath.Join(root, filepath.FromSlash(e.From))}
+		if _, err := os.Lstat(m.From); err != nil {
+			continue
+		}
+		moves = append(moves, m)
+	}
+	return run, moves, nil
+}
+
+// Undo reverts the latest run recorded at root and drops it from the journal.
+func Undo(root string) (err error) {
+	run, moves, err := PlanUndo(root)
+	if err != nil {
+		return err
+	}
+	for _, m := range moves {
+		if er := move(m.From, m.To); er != nil {
+			err = multierror.Append(err, er)
+			continue
+		}
+		fileutil.RemoveEmptyDirs(filepath.Dir(m.From), root)
+	}
+	if err != nil {
+		return err
+	}
+	return dropRun(root, run)
+}
+
+func dropRun(root, run string) error {
+	entries, err := readJournal(root)
+	if err != nil {
+		return err
+	}
+	left := make([]journalEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.Run != run {
+			left = append(left, e)
+		}
+	}
+	path := filepath.Join(root, journalName)
+	if len(left) == 0 {
+		return os.Remove(path)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, e := range left {
+		data, err := json.Marshal(e)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
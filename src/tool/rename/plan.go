@@ -0,0 +1,114 @@
+package rename
+
+import (
+	"ImageZipResize/myerrors"
+	"ImageZipResize/util/concurrent"
+	"ImageZipResize/util/fileutil"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// maxSeq bounds the search of a free number for a path.
+const maxSeq = 100000
+
+// Move renames a file, both paths include the root.
+type Move struct {
+	From string
+	To   string
+}
+
+// Plan renders the new paths of the files below root. Files are numbered in
+// the order of their dates, a path taken by another file or by an earlier
+// move gets the next number, or a suffix like _2 when the template has none.
+// Files which keep their path are left out.
+func Plan(root string, files []File, t *Template) ([]Move, error) {
+	sorted := append([]File(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Time.Equal(sorted[j].Time) {
+			return sorted[i].Time.Before(sorted[j].Time)
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+	var err error
+	moves := make([]Move, 0, len(sorted))
+	taken := make(map[string]bool, len(sorted))
+	for _, f := range sorted {
+		if f.Dir == "" {
+			if rel, er := filepath.Rel(root, filepath.Dir(f.Path)); er == nil {
+				f.Dir = rel
+			}
+		}
+		target, er := pickTarget(root, f, t, taken)
+		if er != nil {
+			err = multierror.Append(err, er)
+			continue
+		}
+		taken[target] = true
+		if target != filepath.Clean(f.Path) {
+			moves = append(moves, Move{From: f.Path, To: target})
+		}
+	}
+	return moves, err
+}
+
+func pickTarget(root string, f File, t *Template, taken map[string]bool) (string, error) {
+	for seq := 1; seq <= maxSeq; seq++ {
+		rel, err := t.Render(f, seq)
+		if err != nil {
+			return "", err
+		}
+		target := filepath.Join(root, rel)
+		if !t.HasSeq() && seq > 1 {
+			ext := filepath.Ext(target)
+			target = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(target, ext), seq, ext)
+		}
+		if target == filepath.Clean(f.Path) {
+			return target, nil
+		}
+		if taken[target] {
+			continue
+		}
+		// files moved away in this run still count, as the moves run in any order
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		return target, nil
+	}
+	return "", fmt.Errorf("%w, no free path for %s", myerrors.ErrRenameConflict, f.Path)
+}
+
+// Apply records the moves in the journal of root and makes them.
+func Apply(root, run string, moves []Move, workers int) (err error) {
+	if len(moves) == 0 {
+		return nil
+	}
+	if err := appendJournal(root, run, moves); err != nil {
+		return err
+	}
+	var mutex sync.Mutex
+	concurrent.ForEach(moves, func(m Move) {
+		if er := move(m.From, m.To); er != nil {
+			slog.Error("rename failed", "path", m.From, "to", m.To, "error", er)
+			mutex.Lock()
+			err = multierror.Append(err, er)
+			mutex.Unlock()
+			return
+		}
+		slog.Info("renamed", "path", m.From, "to", m.To)
+	}, max(1, workers))
+	return err
+}
+
+func move(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+	return fileutil.Rename(from, to)
+}
@@ -0,0 +1,278 @@
+package rename
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, root string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listFiles returns the files below root with the name they were written
+// with, journals left out.
+func listFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || IsJournalPath(path) {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		rel, _ := filepath.Rel(root, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func day(d int) time.Time {
+	return time.Date(2024, 1, d, 10, 0, 0, 0, time.UTC)
+}
+
+func mustTemplate(t *testing.T, source string) *Template {
+	t.Helper()
+	template, err := ParseTemplate(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return template
+}
+
+func TestPlan(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "b.jpg", "a.jpg", "sub/c.jpg")
+	files := []File{
+		{Path: filepath.Join(root, "b.jpg"), Time: day(2)},
+		{Path: filepath.Join(root, "a.jpg"), Time: day(1)},
+		{Path: filepath.Join(root, "sub", "c.jpg"), Time: day(2)},
+	}
+	moves, err := Plan(root, files, mustTemplate(t, "{dir}/{date} {name}{ext}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := relMoves(root, moves)
+	want := map[string]string{
+		"a.jpg":     "2024-01-01 a.jpg",
+		"b.jpg":     "2024-01-02 b.jpg",
+		"sub/c.jpg": "sub/2024-01-02 c.jpg",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("moves = %v, want %v", got, want)
+	}
+	for from, to := range want {
+		if got[from] != to {
+			t.Errorf("%s moves to %s, want %s", from, got[from], to)
+		}
+	}
+}
+
+func TestPlanSeqOrder(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "x.jpg", "y.jpg", "z.jpg")
+	files := []File{
+		{Path: filepath.Join(root, "x.jpg"), Time: day(3)},
+		{Path: filepath.Join(root, "y.jpg"), Time: day(1)},
+		{Path: filepath.Join(root, "z.jpg"), Time: day(2)},
+	}
+	moves, err := Plan(root, files, mustTemplate(t, "{seq:02}{ext}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(moves, func(i, j int) bool { return moves[i].To < moves[j].To })
+	for i, from := range []string{"y.jpg", "z.jpg", "x.jpg"} {
+		if filepath.Base(moves[i].From) != from || filepath.Base(moves[i].To) != []string{"01.jpg", "02.jpg", "03.jpg"}[i] {
+			t.Errorf("move %d = %+v, want %s first by date", i, moves[i], from)
+		}
+	}
+}
+
+func TestApplyUndo(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "a.jpg", "b.jpg")
+	files := []File{
+		{Path: filepath.Join(root, "a.jpg"), Time: day(1)},
+		{Path: filepath.Join(root, "b.jpg"), Time: day(2)},
+	}
+	first, err := Plan(root, files, mustTemplate(t, "{date:2006/01/02}/{name}{ext}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(root, "run1", first, 2); err != nil {
+		t.Fatal(err)
+	}
+	renamed := []File{
+		{Path: filepath.Join(root, "2024", "01", "01", "a.jpg"), Time: day(1)},
+		{Path: filepath.Join(root, "2024", "01", "02", "b.jpg"), Time: day(2)},
+	}
+	second, err := Plan(root, renamed, mustTemplate(t, "{date} {name}{ext}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(root, "run2", second, 2); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, root, map[string]string{"2024-01-01 a.jpg": "a.jpg", "2024-01-02 b.jpg": "b.jpg"})
+
+	// the latest run is undone first, and only it
+	run, moves, err := PlanUndo(root)
+	if err != nil || run != "run2" || len(moves) != 2 {
+		t.Fatalf("PlanUndo() = %s, %v, %v", run, moves, err)
+	}
+	if err := Undo(root); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, root, map[string]string{"2024/01/01/a.jpg": "a.jpg", "2024/01/02/b.jpg": "b.jpg"})
+
+	if err := Undo(root); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, root, map[string]string{"a.jpg": "a.jpg", "b.jpg": "b.jpg"})
+	if _, err := os.Stat(filepath.Join(root, "2024")); !os.IsNotExist(err) {
+		t.Errorf("empty directories left, %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, journalName)); !os.IsNotExist(err) {
+		t.Errorf("journal left, %v", err)
+	}
+	if _, _, err := PlanUndo(root); err == nil {
+		t.Error("PlanUndo() without journal succeeded")
+	}
+}
+
+func TestUndoSkipsMissing(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "a.jpg", "b.jpg")
+	moves := []Move{
+		{From: filepath.Join(root, "a.jpg"), To: filepath.Join(root, "x.jpg")},
+		{From: filepath.Join(root, "b.jpg"), To: filepath.Join(root, "y.jpg")},
+	}
+	if err := Apply(root, "run", moves, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "y.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	_, undo, err := PlanUndo(root)
+	if err != nil || len(undo) != 1 || undo[0].To != filepath.Join(root, "a.jpg") {
+		t.Fatalf("PlanUndo() = %v, %v", undo, err)
+	}
+}
+
+func checkFiles(t *testing.T, root string, want map[string]string) {
+	t.Helper()
+	got := listFiles(t, root)
+	if len(got) != len(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s holds %q, want %q", name, got[name], content)
+		}
+	}
+}
+
+func TestPlanCollisions(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "a/x.jpg", "b/x.jpg", "c/x.jpg", "2024-01-01 x.jpg", "kept.jpg")
+	files := []File{
+		{Path: filepath.Join(root, "a", "x.jpg"), Time: day(1)},
+		{Path: filepath.Join(root, "b", "x.jpg"), Time: day(1)},
+		{Path: filepath.Join(root, "c", "x.jpg"), Time: day(2)},
+		{Path: filepath.Join(root, "kept.jpg"), Time: day(3)},
+	}
+	template := mustTemplate(t, "{date} {name}{ext}")
+	moves, err := Plan(root, files[:3], template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := relMoves(root, moves)
+	// an existing file takes the first name, the earlier move the next one
+	want := map[string]string{
+		"a/x.jpg": "2024-01-01 x_2.jpg",
+		"b/x.jpg": "2024-01-01 x_3.jpg",
+		"c/x.jpg": "2024-01-02 x.jpg",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("moves = %v, want %v", got, want)
+	}
+	for from, to := range want {
+		if got[from] != to {
+			t.Errorf("%s moves to %s, want %s", from, got[from], to)
+		}
+	}
+
+	// a file already at its path keeps it
+	moves, err = Plan(root, files[3:], mustTemplate(t, "{name}{ext}"))
+	if err != nil || len(moves) != 0 {
+		t.Errorf("Plan() of a renamed file = %v, %v", moves, err)
+	}
+}
+
+func TestPlanSeqSkipsTaken(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "001.jpg", "a.jpg", "b.jpg")
+	files := []File{
+		{Path: filepath.Join(root, "a.jpg"), Time: day(1)},
+		{Path: filepath.Join(root, "b.jpg"), Time: day(2)},
+	}
+	moves, err := Plan(root, files, mustTemplate(t, "{seq:03}{ext}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 2 || filepath.Base(moves[0].To) != "002.jpg" || filepath.Base(moves[1].To) != "003.jpg" {
+		t.Errorf("moves = %v, want 002.jpg and 003.jpg", moves)
+	}
+}
+
+func TestPlanWithoutDate(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "a.jpg", "b.jpg")
+	files := []File{
+		{Path: filepath.Join(root, "a.jpg")},
+		{Path: filepath.Join(root, "b.jpg"), Time: day(1)},
+	}
+	moves, err := Plan(root, files, mustTemplate(t, "{date} {name}{ext}"))
+	if err == nil || len(moves) != 1 || filepath.Base(moves[0].From) != "b.jpg" {
+		t.Errorf("Plan() = %v, %v, want the dated file planned and an error", moves, err)
+	}
+}
+
+func TestDatePrefixedPattern(t *testing.T) {
+	for name, want := range map[string]bool{
+		"2024-01-02 a.jpg": true,
+		"2024-01-02_a.jpg": true,
+		"2024-01-02.jpg":   true,
+		"2024-01-0299.jpg": false,
+		"IMG_2024-01-02 a": false,
+	} {
+		if got := DatePrefixedPattern.MatchString(name); got != want {
+			t.Errorf("DatePrefixedPattern matches %q: %v, want %v", name, got, want)
+		}
+	}
+}
+
+// relMoves returns the targets of the moves by their origin, relative to root.
+func relMoves(root string, moves []Move) map[string]string {
+	rel := make(map[string]string, len(moves))
+	for _, m := range moves {
+		from, _ := filepath.Rel(root, m.From)
+		to, _ := filepath.Rel(root, m.To)
+		rel[filepath.ToSlash(from)] = filepath.ToSlash(to)
+	}
+	return rel
+}
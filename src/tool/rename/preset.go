@@ -0,0 +1,30 @@
+package rename
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Preset is a named template, Skip matches the names it already produced.
+type Preset struct {
+	Template string
+	Skip     *regexp.Regexp
+}
+
+// DatePrefixedPattern matches names starting with a date like 2006-01-02.
+var DatePrefixedPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}\D`)
+
+var Presets = map[string]Preset{
+	"date-prefix":  {Template: "{dir}/{date:2006-01-02} {name}{ext}", Skip: DatePrefixedPattern},
+	"date-folders": {Template: "{date:2006/01/02}/{name}{ext}"},
+	"camera":       {Template: "{date:2006-01-02}/{date:150405}_{camera}_{seq:04}{ext}"},
+}
+
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
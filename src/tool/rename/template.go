@@ -0,0 +1,143 @@
+package rename
+
+import (
+	"ImageZipResize/tool/metadata"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File is a file to rename with what templates may refer to, Dir is its
+// directory relative to the root and set by Plan.
+type File struct {
+	Path string
+	Dir  string
+	Time time.Time
+	Meta metadata.Metadata
+}
+
+type part struct {
+	field  string
+	format string
+	text   string
+}
+
+// Template renders the new path of a file relative to its root, from literal
+// text and fields in braces:
+//
+//	{date:LAYOUT}  capture date in a Go layout, 2006-01-02 by default
+//	{name}         name without extension
+//	{ext}          extension with its dot
+//	{dir}          directory holding the file relative to the root
+//	{parent}       name of the directory holding the file
+//	{camera}       camera make and model, unknown without
+//	{seq:WIDTH}    number making the path unique, zero padded to the width
+//
+// A slash in the rendered path moves the file into a subdirectory.
+type Template struct {
+	source string
+	parts  []part
+	seq    bool
+}
+
+func ParseTemplate(source string) (*Template, error) {
+	t := &Template{source: source}
+	for rest := source; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, part{text: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed field in template %q", source)
+		}
+		field, format, _ := strings.Cut(rest[open+1:open+end], ":")
+		switch field {
+		case "date":
+			if format == "" {
+				format = time.DateOnly
+			}
+		case "seq":
+			if format != "" {
+				if width, err := strconv.Atoi(format); err != nil || width < 0 || width > 12 {
+					return nil, fmt.Errorf("invalid width %q of seq in template %q", format, source)
+				}
+			}
+			t.seq = true
+		case "name", "ext", "dir", "parent", "camera":
+			if format != "" {
+				return nil, fmt.Errorf("field %s takes no format in template %q", field, source)
+			}
+		default:
+			return nil, fmt.Errorf("unknown field %q in template %q", field, source)
+		}
+		t.parts = append(t.parts, part{field: field, format: format})
+		rest = rest[open+end+1:]
+	}
+	if len(t.parts) == 0 {
+		return nil, fmt.Errorf("empty template")
+	}
+	return t, nil
+}
+
+func (t *Template) String() string {
+	return t.source
+}
+
+// HasSeq tells whether the template numbers the files itself, otherwise a
+// suffix like _2 separates the files rendered to the same path.
+func (t *Template) HasSeq() bool {
+	return t.seq
+}
+
+// Render returns the path of the file relative to its root, in the layout of
+// the system.
+func (t *Template) Render(f File, seq int) (string, error) {
+	var b strings.Builder
+	ext := filepath.Ext(f.Path)
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.text)
+		case "date":
+			if f.Time.IsZero() {
+				return "", fmt.Errorf("no date for %s", f.Path)
+			}
+			// the layout may hold slashes to make folders
+			b.WriteString(f.Time.Format(p.format))
+		case "name":
+			b.WriteString(clean(strings.TrimSuffix(filepath.Base(f.Path), ext)))
+		case "ext":
+			b.WriteString(ext)
+		case "dir":
+			b.WriteString(filepath.ToSlash(f.Dir))
+		case "parent":
+			b.WriteString(clean(filepath.Base(filepath.Dir(f.Path))))
+		case "camera":
+			camera := f.Meta.Camera()
+			if camera == "" {
+				camera = "unknown"
+			}
+			b.WriteString(clean(camera))
+		case "seq":
+			width, _ := strconv.Atoi(p.format)
+			fmt.Fprintf(&b, "%0*d", width, seq)
+		}
+	}
+	rel := filepath.FromSlash(b.String())
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("template %q renders %s outside of its root", t.source, rel)
+	}
+	return filepath.Clean(rel), nil
+}
+
+// clean keeps values from adding directories.
+func clean(value string) string {
+	return strings.NewReplacer("/", "-", "\\", "-").Replace(strings.TrimSpace(value))
+}
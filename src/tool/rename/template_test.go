@@ -0,0 +1,88 @@
+package rename
+
+import (
+	"ImageZipResize/tool/metadata"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseTemplate(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"{name",
+		"{nope}{ext}",
+		"{name:upper}{ext}",
+		"{seq:x}{ext}",
+		"{seq:13}{ext}",
+	} {
+		if _, err := ParseTemplate(source); err == nil {
+			t.Errorf("ParseTemplate(%q) succeeded", source)
+		}
+	}
+	for source, seq := range map[string]bool{"{name}{ext}": false, "{seq:04}{ext}": true, "{seq}{ext}": true} {
+		template, err := ParseTemplate(source)
+		if err != nil {
+			t.Fatalf("ParseTemplate(%q): %v", source, err)
+		}
+		if template.HasSeq() != seq || template.String() != source {
+			t.Errorf("ParseTemplate(%q) = %q with seq %v", source, template, template.HasSeq())
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	f := File{
+		Path: filepath.FromSlash("/photos/trip/sub/IMG_1.JPG"),
+		Dir:  filepath.FromSlash("trip/sub"),
+		Time: time.Date(2024, 3, 5, 14, 15, 16, 0, time.UTC),
+		Meta: metadata.Metadata{Make: "Apple", Model: "iPhone 15/Pro"},
+	}
+	tests := []struct {
+		template string
+		seq      int
+		want     string
+	}{
+		{"{name}{ext}", 1, "IMG_1.JPG"},
+		{"{dir}/{date} {name}{ext}", 1, "trip/sub/2024-03-05 IMG_1.JPG"},
+		{"{date:2006/01/02}/{name}{ext}", 1, "2024/03/05/IMG_1.JPG"},
+		{"{parent}_{camera}_{seq:03}{ext}", 7, "sub_Apple iPhone 15-Pro_007.JPG"},
+		{"{date:150405}_{seq}{ext}", 12, "141516_12.JPG"},
+		{"a/../{name}{ext}", 1, "IMG_1.JPG"},
+	}
+	for _, test := range tests {
+		template, err := ParseTemplate(test.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := template.Render(f, test.seq)
+		if err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		if want := filepath.FromSlash(test.want); got != want {
+			t.Errorf("%q renders %q, want %q", test.template, got, want)
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	f := File{Path: filepath.FromSlash("/photos/a.jpg")}
+	for _, source := range []string{"{date} {name}{ext}", "../{name}{ext}", "/{name}{ext}/.."} {
+		template, err := ParseTemplate(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := template.Render(f, 1); err == nil {
+			t.Errorf("%q renders %q", source, got)
+		}
+	}
+}
+
+func TestRenderUnknownCamera(t *testing.T) {
+	template, _ := ParseTemplate("{camera}{ext}")
+	got, err := template.Render(File{Path: "a.jpg"}, 1)
+	if err != nil || got != "unknown.jpg" {
+		t.Errorf("Render() = %q, %v, want unknown.jpg", got, err)
+	}
+}
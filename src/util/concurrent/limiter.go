@@ -0,0 +1,60 @@
+package concurrent
+
+import "sync"
+
+// Limiter is a weighted semaphore which also limits the number of holders,
+// both limits can be changed while it is in use.
+type Limiter struct {
+	mutex       sync.Mutex
+	cond        *sync.Cond
+	weightLimit int64
+	weightUsed  int64
+	countLimit  int
+	countUsed   int
+}
+
+func NewLimiter(weight int64, count int) *Limiter {
+	l := &Limiter{weightLimit: weight, countLimit: count}
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+// Acquire blocks until the weight fits in the limits. A weight larger than the
+// limit is admitted once nothing else is running, so it cannot block forever.
+func (l *Limiter) Acquire(weight int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for l.countUsed > 0 && (l.countUsed >= l.countLimit || l.weightUsed+weight > l.weightLimit) {
+		l.cond.Wait()
+	}
+	l.countUsed++
+	l.weightUsed += weight
+}
+
+func (l *Limiter) Release(weight int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.countUsed--
+	l.weightUsed -= weight
+	l.cond.Broadcast()
+}
+
+func (l *Limiter) SetLimit(weight int64, count int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.weightLimit = weight
+	l.countLimit = max(1, count)
+	l.cond.Broadcast()
+}
+
+func (l *Limiter) Limit() (weight int64, count int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.weightLimit, l.countLimit
+}
+
+func (l *Limiter) Used() (weight int64, count int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.weightUsed, l.countUsed
+}
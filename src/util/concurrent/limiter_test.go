@@ -0,0 +1,76 @@
+package concurrent
+
+import (
+	"testing"
+	"time"
+)
+
+func acquired(l *Limiter, weight int64) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		l.Acquire(weight)
+		close(done)
+	}()
+	return done
+}
+
+func waitFor(t *testing.T, done <-chan struct{}, want bool) {
+	t.Helper()
+	select {
+	case <-done:
+		if !want {
+			t.Fatal("acquired while over the limit")
+		}
+	case <-time.After(50 * time.Millisecond):
+		if want {
+			t.Fatal("not acquired within the limit")
+		}
+	}
+}
+
+func TestLimiterWeight(t *testing.T) {
+	l := NewLimiter(10, 5)
+	l.Acquire(6)
+	blocked := acquired(l, 5)
+	waitFor(t, blocked, false)
+	l.Release(6)
+	waitFor(t, blocked, true)
+	if weight, count := l.Used(); weight != 5 || count != 1 {
+		t.Fatalf("used %d, %d, want 5, 1", weight, count)
+	}
+}
+
+func TestLimiterCount(t *testing.T) {
+	l := NewLimiter(100, 2)
+	l.Acquire(1)
+	l.Acquire(1)
+	blocked := acquired(l, 1)
+	waitFor(t, blocked, false)
+	l.SetLimit(100, 3)
+	waitFor(t, blocked, true)
+	if weight, count := l.Limit(); weight != 100 || count != 3 {
+		t.Fatalf("limit %d, %d, want 100, 3", weight, count)
+	}
+}
+
+func TestLimiterOverweightWhenIdle(t *testing.T) {
+	l := NewLimiter(10, 2)
+	waitFor(t, acquired(l, 50), true)
+	blocked := acquired(l, 1)
+	waitFor(t, blocked, false)
+	l.Release(50)
+	waitFor(t, blocked, true)
+}
+
+func TestLimiterShrink(t *testing.T) {
+	l := NewLimiter(10, 4)
+	l.Acquire(4)
+	l.SetLimit(5, 0)
+	if _, count := l.Limit(); count != 1 {
+		t.Fatalf("count limit %d, want at least 1", count)
+	}
+	blocked := acquired(l, 2)
+	waitFor(t, blocked, false)
+	l.Release(4)
+	waitFor(t, blocked, true)
+}
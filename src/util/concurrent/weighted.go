@@ -0,0 +1,51 @@
+package concurrent
+
+import (
+	"sync"
+)
+
+// Budget limits the total weight of the values iterated at the same time.
+// Values heavier than HugeWeight run on a separate lane with HugeWorkers workers,
+// so they do not hold up the light ones. With a Limiter the limits can be
+// changed at runtime, up to MaxWorkers workers for the light values.
+type Budget struct {
+	Limit       int64
+	Workers     int
+	MaxWorkers  int
+	HugeWeight  int64
+	HugeWorkers int
+	Limiter     *Limiter
+}
+
+func ForEachWeighted[T any](slice []T, weight func(value T) int64, budget Budget, iterator func(value T)) {
+	limiter := budget.Limiter
+	if limiter == nil {
+		limiter = NewLimiter(budget.Limit, budget.Workers+budget.HugeWorkers)
+	}
+	normal := make([]T, 0, len(slice))
+	huge := make([]T, 0)
+	for _, value := range slice {
+		if budget.HugeWeight > 0 && weight(value) > budget.HugeWeight {
+			huge = append(huge, value)
+		} else {
+			normal = append(normal, value)
+		}
+	}
+	run := func(value T) {
+		w := max(1, weight(value))
+		limiter.Acquire(w)
+		defer limiter.Release(w)
+		iterator(value)
+	}
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ForEach(huge, run, max(1, budget.HugeWorkers))
+	}()
+	go func() {
+		defer wg.Done()
+		ForEach(normal, run, max(1, budget.Workers, budget.MaxWorkers))
+	}()
+	wg.Wait()
+}
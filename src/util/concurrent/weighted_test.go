@@ -0,0 +1,55 @@
+package concurrent
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachWeightedStaysInBudget(t *testing.T) {
+	values := make([]int64, 200)
+	for i := range values {
+		values[i] = int64(i%7 + 1)
+	}
+	budget := Budget{Limit: 10, Workers: 4, HugeWeight: 5, HugeWorkers: 1}
+	var used, peak atomic.Int64
+	var hugeRunning, hugePeak atomic.Int64
+	var done atomic.Int64
+	ForEachWeighted(values, func(v int64) int64 { return v }, budget, func(v int64) {
+		now := used.Add(v)
+		for old := peak.Load(); now > old && !peak.CompareAndSwap(old, now); old = peak.Load() {
+		}
+		if v > budget.HugeWeight {
+			h := hugeRunning.Add(1)
+			for old := hugePeak.Load(); h > old && !hugePeak.CompareAndSwap(old, h); old = hugePeak.Load() {
+			}
+			defer hugeRunning.Add(-1)
+		}
+		time.Sleep(time.Millisecond)
+		used.Add(-v)
+		done.Add(1)
+	})
+	if done.Load() != int64(len(values)) {
+		t.Fatalf("iterated %d values, want %d", done.Load(), len(values))
+	}
+	if peak.Load() > budget.Limit {
+		t.Fatalf("peak weight %d over the limit %d", peak.Load(), budget.Limit)
+	}
+	if hugePeak.Load() > int64(budget.HugeWorkers) {
+		t.Fatalf("%d huge values at once, want at most %d", hugePeak.Load(), budget.HugeWorkers)
+	}
+}
+
+func TestForEachWeightedAdmitsOverweight(t *testing.T) {
+	var mutex sync.Mutex
+	seen := make([]int64, 0)
+	ForEachWeighted([]int64{1, 100, 2}, func(v int64) int64 { return v }, Budget{Limit: 10, Workers: 2}, func(v int64) {
+		mutex.Lock()
+		seen = append(seen, v)
+		mutex.Unlock()
+	})
+	if len(seen) != 3 {
+		t.Fatalf("iterated %v, want all three values", seen)
+	}
+}
@@ -49,3 +49,24 @@ func (w writeCloser) Close() error {
 	}
 	return c.Close()
 }
+
+// WithClosers returns a ReadCloser of r which closes r, when it is a Closer,
+// and then the closers, such as the archive holding r.
+func WithClosers(r io.Reader, closers ...io.Closer) io.ReadCloser {
+	return &multiCloser{Reader: r, closers: append([]io.Closer{NewReadCloser(r)}, closers...)}
+}
+
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiCloser) Close() error {
+	var err error
+	for _, c := range m.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
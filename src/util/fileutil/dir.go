@@ -0,0 +1,22 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RemoveEmptyDirs removes dir and its parents while they are empty, up to
+// but excluding stop.
+func RemoveEmptyDirs(dir, stop string) {
+	for {
+		rel, err := filepath.Rel(stop, dir)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+Separator) {
+			return
+		}
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
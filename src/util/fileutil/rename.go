@@ -0,0 +1,75 @@
+package fileutil
+
+import (
+	"ImageZipResize/myerrors"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// Rename works like os.Rename but never replaces an existing target.
+func Rename(from, to string) error {
+	_, err := os.Lstat(to)
+	if err == nil {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: myerrors.ErrRenameConflict}
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// Move works like Rename and falls back to copying when the target is on
+// another device. The copy keeps the modification time of the source.
+func Move(from, to string) error {
+	err := Rename(from, to)
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+		return err
+	}
+	stat, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, stat.Mode().Perm())
+	if os.IsExist(err) {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: myerrors.ErrRenameConflict}
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(to)
+		return err
+	}
+	if err := os.Chtimes(to, stat.ModTime(), stat.ModTime()); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(from)
+}
+
+// ReplaceWithLink replaces file by a hard link to target, file stays
+// untouched when the link cannot be made.
+func ReplaceWithLink(target, file string) error {
+	tmp := file + ".link.tmp"
+	if err := os.Link(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
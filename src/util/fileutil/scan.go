@@ -3,14 +3,20 @@ package fileutil
 import (
 	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/hashicorp/go-multierror"
 )
 
 var Separator = fmt.Sprintf("%c", filepath.Separator)
 
 func ScanFiles(dir string) (files []string, err error) {
 	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 		if d.IsDir() {
 			return nil
 		}
@@ -29,3 +35,35 @@ func ScanFiles(dir string) (files []string, err error) {
 func SplitPath(path string) []string {
 	return strings.Split(path, Separator)
 }
+
+// SplitArgs separates command line paths into regular files and directories,
+// any other argument is returned as invalid.
+func SplitArgs(args []string) (files []string, dirs []string, invalid []string) {
+	for _, arg := range args {
+		stat, err := os.Stat(arg)
+		switch {
+		case err != nil:
+			invalid = append(invalid, arg)
+		case stat.IsDir():
+			dirs = append(dirs, arg)
+		case stat.Mode().IsRegular():
+			files = append(files, arg)
+		default:
+			invalid = append(invalid, arg)
+		}
+	}
+	return
+}
+
+// ScanArgs returns the file arguments followed by the files found in the directory arguments.
+func ScanArgs(args []string) (files []string, err error) {
+	files, dirs, _ := SplitArgs(args)
+	for _, dir := range dirs {
+		found, er := ScanFiles(dir)
+		if er != nil {
+			err = multierror.Append(err, fmt.Errorf("scan files %s failed, %w", dir, er))
+		}
+		files = append(files, found...)
+	}
+	return files, err
+}
@@ -22,3 +22,12 @@ func GetTempDir(base, filename string) (string, error) {
 	}
 	return dir, nil
 }
+
+func IsCachePath(path string) bool {
+	for _, name := range SplitPath(path) {
+		if name == cacheDir {
+			return true
+		}
+	}
+	return false
+}
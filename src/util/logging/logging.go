@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// console is the terminal part of the log output, it can be redirected while
+// a progress display owns the terminal.
+var console = &switchWriter{w: os.Stderr}
+
+type switchWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.w.Write(p)
+}
+
+func SetConsole(w io.Writer) {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	console.w = w
+}
+
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return level, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// New creates a logger writing to the console and, when file is not empty,
+// appending to the file, and makes it the default logger of slog and log.
+func New(level slog.Level, format string, file string) (*slog.Logger, io.Closer, error) {
+	var out io.Writer = console
+	var closer io.Closer = io.NopCloser(nil)
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = io.MultiWriter(console, f)
+		closer = f
+	}
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(out, options)
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("unknown log format %q", format)
+	}
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	return logger, closer, nil
+}
@@ -0,0 +1,85 @@
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// Estimator predicts the time left from the pixels left, learning the time a
+// single job takes per megapixel for each kind of image with exponential smoothing.
+type Estimator struct {
+	mutex       sync.Mutex
+	alpha       float64
+	defaultRate float64
+	rates       map[string]float64
+	remaining   map[string]float64
+}
+
+func NewEstimator(alpha float64, defaultRate time.Duration) *Estimator {
+	return &Estimator{
+		alpha:       alpha,
+		defaultRate: defaultRate.Seconds(),
+		rates:       make(map[string]float64),
+		remaining:   make(map[string]float64),
+	}
+}
+
+func megapixels(pixels int64) float64 {
+	return float64(pixels) / 1e6
+}
+
+// Plan adds the pixels of a job to do.
+func (e *Estimator) Plan(kind string, pixels int64) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.remaining[kind] += megapixels(pixels)
+}
+
+// Done removes the pixels of a finished job and learns from its duration.
+func (e *Estimator) Done(kind string, pixels int64, elapsed time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	mp := megapixels(pixels)
+	e.remaining[kind] = max(0, e.remaining[kind]-mp)
+	if mp <= 0 {
+		return
+	}
+	rate := elapsed.Seconds() / mp
+	if old, ok := e.rates[kind]; ok {
+		rate = e.alpha*rate + (1-e.alpha)*old
+	}
+	e.rates[kind] = rate
+}
+
+// Skip removes the pixels of a failed job without learning from it.
+func (e *Estimator) Skip(kind string, pixels int64) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.remaining[kind] = max(0, e.remaining[kind]-megapixels(pixels))
+}
+
+// Remaining returns the time left when the jobs run on the given number of workers.
+func (e *Estimator) Remaining(workers int) time.Duration {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	seconds := 0.0
+	for kind, mp := range e.remaining {
+		seconds += mp * e.rate(kind)
+	}
+	return time.Duration(seconds / float64(max(1, workers)) * float64(time.Second))
+}
+
+// rate falls back to the average of the learned kinds before a kind has finished any job.
+func (e *Estimator) rate(kind string) float64 {
+	if rate, ok := e.rates[kind]; ok {
+		return rate
+	}
+	if len(e.rates) == 0 {
+		return e.defaultRate
+	}
+	sum := 0.0
+	for _, rate := range e.rates {
+		sum += rate
+	}
+	return sum / float64(len(e.rates))
+}
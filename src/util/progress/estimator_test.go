@@ -0,0 +1,83 @@
+package progress
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimatorRate(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// durations of the finished jobs of 1 megapixel
+		done []time.Duration
+		want time.Duration
+	}{
+		{"default", nil, 200 * time.Millisecond},
+		{"first job", []time.Duration{time.Second}, time.Second},
+		{"smoothed", []time.Duration{time.Second, 2 * time.Second}, 1300 * time.Millisecond},
+		{"smoothed twice", []time.Duration{time.Second, 2 * time.Second, 2 * time.Second}, 1510 * time.Millisecond},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEstimator(0.3, 200*time.Millisecond)
+			for _, d := range tt.done {
+				e.Plan("static", 1e6)
+				e.Done("static", 1e6, d)
+			}
+			e.Plan("static", 1e6)
+			if got := e.Remaining(1); got.Round(time.Millisecond) != tt.want {
+				t.Errorf("Remaining = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimatorSkip(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		planned int64
+		skipped int64
+		want    time.Duration
+	}{
+		{"part", 3e6, 1e6, 2 * time.Second},
+		{"all", 3e6, 3e6, 0},
+		{"more than planned", 1e6, 2e6, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEstimator(0.3, time.Second)
+			e.Plan("static", tt.planned)
+			e.Skip("static", tt.skipped)
+			if got := e.Remaining(1); got != tt.want {
+				t.Errorf("Remaining = %v, want %v", got, tt.want)
+			}
+			// a skipped job does not teach a rate
+			if len(e.rates) != 0 {
+				t.Errorf("rates = %v after skip", e.rates)
+			}
+		})
+	}
+}
+
+func TestEstimatorRemaining(t *testing.T) {
+	e := NewEstimator(0.3, time.Second)
+	e.Plan("static", 1e6)
+	e.Done("static", 1e6, time.Second)
+	e.Plan("animated", 1e6)
+	e.Done("animated", 1e6, 3*time.Second)
+	e.Plan("static", 4e6)
+	e.Plan("animated", 2e6)
+	// a kind without a finished job takes the average rate of the others
+	e.Plan("archive", 1e6)
+	for _, tt := range []struct {
+		workers int
+		want    time.Duration
+	}{
+		{0, 12 * time.Second},
+		{1, 12 * time.Second},
+		{2, 6 * time.Second},
+		{3, 4 * time.Second},
+	} {
+		if got := e.Remaining(tt.workers); got.Round(time.Millisecond) != tt.want {
+			t.Errorf("Remaining(%d) = %v, want %v", tt.workers, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package progress
+
+import (
+	"ImageZipResize/util/system"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const refreshInterval = 200 * time.Millisecond
+
+func IsTerminal(file *os.File) bool {
+	return term.IsTerminal(int(file.Fd()))
+}
+
+type task struct {
+	file    string
+	started time.Time
+}
+
+// Display draws an overall progress bar with throughput, saved bytes and ETA,
+// followed by one line per running task, at the bottom of a terminal.
+type Display struct {
+	out     *os.File
+	total   int64
+	eta     func() time.Duration
+	mutex   sync.Mutex
+	started time.Time
+	done    int64
+	failed  int64
+	bytesIn int64
+	saved   int64
+	tasks   map[int]task
+	lines   int
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func New(out *os.File, total int64, eta func() time.Duration) *Display {
+	return &Display{
+		out:     out,
+		total:   total,
+		eta:     eta,
+		started: time.Now(),
+		tasks:   make(map[int]task),
+	}
+}
+
+func (d *Display) Start() {
+	d.stop = make(chan struct{})
+	d.stopped = make(chan struct{})
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				d.mutex.Lock()
+				d.redraw()
+				d.mutex.Unlock()
+				return
+			case <-ticker.C:
+				d.mutex.Lock()
+				d.redraw()
+				d.mutex.Unlock()
+			}
+		}
+	}()
+}
+
+func (d *Display) Stop() {
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	<-d.stopped
+	d.stop = nil
+}
+
+// Begin shows a running task and returns its id for End.
+func (d *Display) Begin(file string) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	id := 0
+	for {
+		if _, used := d.tasks[id]; !used {
+			break
+		}
+		id++
+	}
+	d.tasks[id] = task{file: file, started: time.Now()}
+	return id
+}
+
+// End removes a task, counting the input bytes and the bytes saved by it.
+func (d *Display) End(id int, failed bool, bytesIn int64, bytesOut int64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.tasks, id)
+	d.done++
+	if failed {
+		d.failed++
+		return
+	}
+	d.bytesIn += bytesIn
+	d.saved += max(0, bytesIn-bytesOut)
+}
+
+// Writer returns a writer which prints above the progress display, used as log output.
+func (d *Display) Writer(w io.Writer) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		d.clear()
+		n, err := w.Write(p)
+		d.draw()
+		return n, err
+	})
+}
+
+// Title sets the title of the terminal and its progress between the redraws.
+func (d *Display) Title(title string, percent int64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	WriteTitle(d.out, title, percent)
+}
+
+// WriteTitle sets the title of the terminal and the progress shown in its tab
+// or taskbar.
+func WriteTitle(out io.Writer, title string, percent int64) {
+	fmt.Fprintf(out, "\033]9;4;1;%d\a\033]0;%s\a", percent, title)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func (d *Display) redraw() {
+	d.clear()
+	d.draw()
+}
+
+func (d *Display) clear() {
+	if d.lines == 0 {
+		return
+	}
+	fmt.Fprintf(d.out, "\033[%dF\033[J", d.lines)
+	d.lines = 0
+}
+
+func (d *Display) draw() {
+	width, _, err := term.GetSize(int(d.out.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	elapsed := time.Since(d.started)
+	seconds := max(elapsed.Seconds(), 0.001)
+	percent := float64(d.done) / float64(max(1, d.total))
+
+	buf := new(bytes.Buffer)
+	barWidth := 30
+	filled := int(percent * float64(barWidth))
+	fmt.Fprintf(buf, "[%s%s] %d/%d %3.0f%%", strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), d.done, d.total, percent*100)
+	if d.failed > 0 {
+		fmt.Fprintf(buf, " (%d failed)", d.failed)
+	}
+	fmt.Fprintf(buf, " | %.2f files/s %s/s | saved %s | ETA %s",
+		float64(d.done)/seconds, system.ByteSize(float64(d.bytesIn)/seconds), system.ByteSize(d.saved), d.eta())
+	header := []rune(buf.String())
+	if len(header) >= width {
+		header = header[:width-1]
+	}
+	fmt.Fprintln(d.out, string(header))
+	d.lines = 1
+
+	ids := make([]int, 0, len(d.tasks))
+	for id := range d.tasks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		t := d.tasks[id]
+		line := fmt.Sprintf("  #%-2d %6s %s", id+1, time.Since(t.started).Truncate(100*time.Millisecond), t.file)
+		fmt.Fprintln(d.out, truncate(line, width))
+		d.lines++
+	}
+}
+
+// truncate shortens a line to the width, keeping its end which holds the file name.
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) < width {
+		return line
+	}
+	keep := max(0, width-4)
+	return "..." + string(runes[len(runes)-keep:])
+}
@@ -0,0 +1,28 @@
+package progress
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTitle(t *testing.T) {
+	out, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	d := New(out, 4, func() time.Duration { return time.Minute })
+	d.Writer(out).Write([]byte("log line\n"))
+	d.Title("[1/4] Image Resize", 25)
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the title follows the progress lines drawn after the log line
+	want := "\033]9;4;1;25\a\033]0;[1/4] Image Resize\a"
+	if !strings.HasPrefix(string(data), "log line\n") || !strings.HasSuffix(string(data), want) {
+		t.Fatalf("output = %q", data)
+	}
+}
@@ -0,0 +1,135 @@
+package system
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// the cgroup mount and the cgroup list of the process, variables for the tests
+var (
+	cgroupRoot = "/sys/fs/cgroup"
+	procCgroup = "/proc/self/cgroup"
+)
+
+// cgroupV1Unlimited is the page aligned max int64 reported by cgroup v1 for no limit.
+const cgroupV1Unlimited = math.MaxInt64 / 4096 * 4096
+
+// cgroupDir returns the cgroup directory of the current process for a controller,
+// an empty controller means the cgroup v2 unified hierarchy. file is a control
+// file which must exist in the directory.
+func cgroupDir(controller string, file string) (string, bool) {
+	proc, err := os.Open(procCgroup)
+	if err != nil {
+		return "", false
+	}
+	defer proc.Close()
+	scanner := bufio.NewScanner(proc)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if controller == "" && parts[0] != "0" {
+			continue
+		}
+		if controller != "" && !hasController(parts[1], controller) {
+			continue
+		}
+		base := filepath.Join(cgroupRoot, controller)
+		// inside a cgroup namespace the own cgroup is mounted as the root
+		for _, dir := range []string{filepath.Join(base, parts[2]), base} {
+			if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+				return dir, true
+			}
+		}
+	}
+	return "", false
+}
+
+func hasController(list string, controller string) bool {
+	for _, name := range strings.Split(list, ",") {
+		if name == controller {
+			return true
+		}
+	}
+	return false
+}
+
+func readCgroupValue(file string) (uint64, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// cgroupMemory returns the memory limit and usage of the cgroup, ok is false
+// when the process is not limited by a cgroup v2 or v1 memory controller.
+func cgroupMemory() (limit uint64, current uint64, ok bool) {
+	if dir, found := cgroupDir("", "memory.max"); found {
+		limit, ok = readCgroupValue(filepath.Join(dir, "memory.max"))
+		current, _ = readCgroupValue(filepath.Join(dir, "memory.current"))
+		return limit, current, ok
+	}
+	if dir, found := cgroupDir("memory", "memory.limit_in_bytes"); found {
+		limit, ok = readCgroupValue(filepath.Join(dir, "memory.limit_in_bytes"))
+		if limit >= cgroupV1Unlimited {
+			return 0, 0, false
+		}
+		current, _ = readCgroupValue(filepath.Join(dir, "memory.usage_in_bytes"))
+		return limit, current, ok
+	}
+	return 0, 0, false
+}
+
+// cgroupCpus returns the number of cpus the cgroup quota allows,
+// ok is false when there is no quota.
+func cgroupCpus() (cpus float64, ok bool) {
+	if dir, found := cgroupDir("", "cpu.max"); found {
+		data, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+		if err != nil {
+			return 0, false
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return parseCpuQuota(fields[0], fields[1])
+	}
+	if dir, found := cgroupDir("cpu", "cpu.cfs_quota_us"); found {
+		quota, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+		if err != nil {
+			return 0, false
+		}
+		period, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+		if err != nil {
+			return 0, false
+		}
+		return parseCpuQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+	}
+	return 0, false
+}
+
+func parseCpuQuota(quota string, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
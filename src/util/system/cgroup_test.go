@@ -0,0 +1,132 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fakeCgroup points the cgroup lookups at a temporary tree with the files.
+func fakeCgroup(t *testing.T, proc string, files map[string]string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, "fs", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	procFile := filepath.Join(root, "cgroup")
+	if err := os.WriteFile(procFile, []byte(proc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	oldRoot, oldProc := cgroupRoot, procCgroup
+	cgroupRoot, procCgroup = filepath.Join(root, "fs"), procFile
+	t.Cleanup(func() {
+		cgroupRoot, procCgroup = oldRoot, oldProc
+	})
+}
+
+func TestCgroupV2(t *testing.T) {
+	fakeCgroup(t, "0::/user.slice/job\n", map[string]string{
+		"user.slice/job/memory.max":     "1073741824\n",
+		"user.slice/job/memory.current": "268435456\n",
+		"user.slice/job/cpu.max":        "150000 100000\n",
+	})
+	limit, current, ok := cgroupMemory()
+	if !ok || limit != 1<<30 || current != 1<<28 {
+		t.Fatalf("cgroupMemory = %d, %d, %v", limit, current, ok)
+	}
+	cpus, ok := cgroupCpus()
+	if !ok || cpus != 1.5 {
+		t.Fatalf("cgroupCpus = %v, %v, want 1.5", cpus, ok)
+	}
+}
+
+func TestCgroupV2Unlimited(t *testing.T) {
+	fakeCgroup(t, "0::/\n", map[string]string{
+		"memory.max": "max\n",
+		"cpu.max":    "max 100000\n",
+	})
+	if _, _, ok := cgroupMemory(); ok {
+		t.Fatal("cgroupMemory limited by max")
+	}
+	if _, ok := cgroupCpus(); ok {
+		t.Fatal("cgroupCpus limited by max")
+	}
+}
+
+func TestCgroupV2Namespace(t *testing.T) {
+	// inside a cgroup namespace the own cgroup is the mounted root
+	fakeCgroup(t, "0::/docker/abc\n", map[string]string{
+		"memory.max": "536870912\n",
+	})
+	limit, _, ok := cgroupMemory()
+	if !ok || limit != 1<<29 {
+		t.Fatalf("cgroupMemory = %d, %v", limit, ok)
+	}
+}
+
+func TestCgroupV1(t *testing.T) {
+	fakeCgroup(t, "12:cpu,cpuacct:/job\n11:memory:/job\n", map[string]string{
+		"memory/job/memory.limit_in_bytes": "2147483648\n",
+		"memory/job/memory.usage_in_bytes": "1024\n",
+		"cpu/job/cpu.cfs_quota_us":         "200000\n",
+		"cpu/job/cpu.cfs_period_us":        "100000\n",
+	})
+	limit, current, ok := cgroupMemory()
+	if !ok || limit != 2<<30 || current != 1024 {
+		t.Fatalf("cgroupMemory = %d, %d, %v", limit, current, ok)
+	}
+	cpus, ok := cgroupCpus()
+	if !ok || cpus != 2 {
+		t.Fatalf("cgroupCpus = %v, %v, want 2", cpus, ok)
+	}
+}
+
+func TestCgroupV1Unlimited(t *testing.T) {
+	fakeCgroup(t, "11:memory:/\n12:cpu:/\n", map[string]string{
+		"memory/memory.limit_in_bytes": strconv.FormatInt(cgroupV1Unlimited, 10),
+		"cpu/cpu.cfs_quota_us":         "-1",
+		"cpu/cpu.cfs_period_us":        "100000",
+	})
+	if _, _, ok := cgroupMemory(); ok {
+		t.Fatal("cgroupMemory limited by the unlimited value")
+	}
+	if _, ok := cgroupCpus(); ok {
+		t.Fatal("cgroupCpus limited by a negative quota")
+	}
+}
+
+func TestNoCgroup(t *testing.T) {
+	fakeCgroup(t, "", nil)
+	if _, _, ok := cgroupMemory(); ok {
+		t.Fatal("cgroupMemory without cgroup")
+	}
+	if _, ok := cgroupCpus(); ok {
+		t.Fatal("cgroupCpus without cgroup")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for input, want := range map[string]ByteSize{
+		"1024":   1024,
+		"4GiB":   4 << 30,
+		"512MiB": 512 << 20,
+		"1.5KiB": 1536,
+	} {
+		got, err := ParseByteSize(input)
+		if err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "-1GiB", "lots"} {
+		if _, err := ParseByteSize(input); err == nil {
+			t.Errorf("ParseByteSize(%q) succeeded", input)
+		}
+	}
+}
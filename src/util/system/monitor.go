@@ -0,0 +1,104 @@
+package system
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/mem"
+)
+
+type Resources struct {
+	Time            time.Time
+	MemoryAvailable ByteSize
+	// SwapRate is the bytes swapped in and out per second since the previous sample.
+	SwapRate ByteSize
+	// CpuLoad is the busy percentage of all cpus since the previous sample.
+	CpuLoad       float64
+	CgroupLimit   ByteSize
+	CgroupCurrent ByteSize
+}
+
+func (r Resources) String() string {
+	s := fmt.Sprintf("available %s, swap %s/s, cpu %.0f%%", r.MemoryAvailable, r.SwapRate, r.CpuLoad)
+	if r.CgroupLimit > 0 {
+		s += fmt.Sprintf(", cgroup %s/%s", r.CgroupCurrent, r.CgroupLimit)
+	}
+	return s
+}
+
+// Monitor samples the system resources periodically.
+type Monitor struct {
+	interval time.Duration
+	mutex    sync.Mutex
+	latest   Resources
+	swapped  uint64
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewMonitor(interval time.Duration) *Monitor {
+	m := &Monitor{interval: interval}
+	m.latest = m.sample()
+	return m
+}
+
+// Start samples in the background and calls onSample with every new sample.
+func (m *Monitor) Start(onSample func(r Resources)) {
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				r := m.sample()
+				if onSample != nil {
+					onSample(r)
+				}
+			}
+		}
+	}()
+}
+
+func (m *Monitor) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+}
+
+func (m *Monitor) Latest() Resources {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.latest
+}
+
+func (m *Monitor) sample() Resources {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	r := Resources{Time: time.Now(), MemoryAvailable: ByteSize(GetAvailableMemory())}
+	if swap, err := mem.SwapMemory(); err == nil {
+		swapped := swap.Sin + swap.Sout
+		if elapsed := r.Time.Sub(m.latest.Time).Seconds(); !m.latest.Time.IsZero() && elapsed > 0 && swapped >= m.swapped {
+			r.SwapRate = ByteSize(float64(swapped-m.swapped) / elapsed)
+		}
+		m.swapped = swapped
+	}
+	if percent, err := cpu.Percent(0, false); err == nil && len(percent) > 0 {
+		r.CpuLoad = percent[0]
+	}
+	if limit, current, ok := cgroupMemory(); ok {
+		r.CgroupLimit = ByteSize(limit)
+		r.CgroupCurrent = ByteSize(current)
+	}
+	m.latest = r
+	return r
+}
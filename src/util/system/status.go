@@ -4,14 +4,19 @@ import (
 	"fmt"
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/mem"
-	"log"
+	"log/slog"
+	"math"
 	"os"
 	"runtime"
-	slices_ "slices"
+	"strconv"
+	"strings"
 )
 
+const minMemoryLimit uint64 = 256 * 1024 * 1024
+
+var threads uint64 = 4
 var parallel uint64 = 4
-var memoryLimit uint64 = 256 * 1024 * 1024
+var memoryLimit uint64 = minMemoryLimit
 var memoryAvailable uint64 = 1024 * 1024 * 1024
 
 type ByteSize uint64
@@ -35,14 +40,53 @@ func (b ByteSize) String() string {
 	}
 }
 
+func ParseByteSize(s string) (ByteSize, error) {
+	value := strings.TrimSpace(s)
+	upper := strings.ToUpper(value)
+	unit := uint64(1)
+	for _, u := range []struct {
+		suffixes []string
+		size     uint64
+	}{
+		{[]string{"GIB", "GB", "G"}, 1024 * 1024 * 1024},
+		{[]string{"MIB", "MB", "M"}, 1024 * 1024},
+		{[]string{"KIB", "KB", "K"}, 1024},
+		{[]string{"B"}, 1},
+	} {
+		found := false
+		for _, suffix := range u.suffixes {
+			if strings.HasSuffix(upper, suffix) {
+				value = strings.TrimSpace(value[:len(value)-len(suffix)])
+				unit, found = u.size, true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	return ByteSize(n * float64(unit)), nil
+}
+
 func init() {
-	threads := GetCpuCores()
+	threads = GetCpuCores()
 	if !allowParallel() {
 		threads = 1
 	}
-	memoryAvailable = GetAvailableMemory() / 2
+	configure(GetAvailableMemory() / 2)
+}
+
+// configure splits the memory between the threads, running fewer of them
+// when each would get less than minMemoryLimit.
+func configure(available uint64) {
+	memoryAvailable = available
 	memoryPerCore := memoryAvailable / threads
-	if memoryPerCore < memoryLimit {
+	if memoryPerCore < minMemoryLimit {
+		memoryLimit = minMemoryLimit
 		parallel = max(1, memoryAvailable/memoryLimit)
 	} else {
 		memoryLimit = memoryPerCore
@@ -50,14 +94,12 @@ func init() {
 	}
 }
 
+// allowParallel tells whether PARALLEL=OFF turns parallel jobs off, the
+// --no-parallel flag is applied through SetParallelism once it is parsed.
 func allowParallel() bool {
 	envParallel, _ := os.LookupEnv("PARALLEL")
 	if envParallel == "OFF" {
-		log.Printf("run without parallel: PARALLEL=%s", envParallel)
-		return false
-	}
-	if slices_.Contains(os.Args[1:], "--no-parallel") {
-		log.Printf("run without parallel: --no-parallel")
+		slog.Info("run without parallel", "PARALLEL", envParallel)
 		return false
 	}
 	return true
@@ -67,6 +109,16 @@ func GetParallelism() uint64 {
 	return parallel
 }
 
+func SetParallelism(n uint64) {
+	parallel = max(1, n)
+	memoryLimit = memoryAvailable / parallel
+}
+
+// SetMemory sets the total memory all jobs may use instead of half of the available memory.
+func SetMemory(size ByteSize) {
+	configure(uint64(size))
+}
+
 func GetMemoryLimit() ByteSize {
 	return ByteSize(memoryLimit)
 }
@@ -75,18 +127,30 @@ func GetMemoryAvailable() ByteSize {
 	return ByteSize(memoryAvailable)
 }
 
+// GetCpuCores returns the physical core count, limited by the cgroup cpu quota.
 func GetCpuCores() uint64 {
-	cnt, err := cpu.Counts(false)
-	if err != nil {
-		return uint64(runtime.NumCPU())
+	cores := uint64(runtime.NumCPU())
+	if cnt, err := cpu.Counts(false); err == nil && cnt > 0 {
+		cores = uint64(cnt)
+	}
+	if quota, ok := cgroupCpus(); ok {
+		cores = min(cores, max(1, uint64(math.Ceil(quota))))
 	}
-	return uint64(cnt)
+	return cores
 }
 
+// GetAvailableMemory returns the available host memory, limited by what is
+// left of the cgroup memory limit.
 func GetAvailableMemory() uint64 {
-	vm, err := mem.VirtualMemory()
-	if err != nil {
-		return 4 * 1024 * 1024 * 1024
+	available := uint64(4 * 1024 * 1024 * 1024)
+	if vm, err := mem.VirtualMemory(); err == nil {
+		available = vm.Available
+	}
+	if limit, current, ok := cgroupMemory(); ok {
+		if limit <= current {
+			return 0
+		}
+		available = min(available, limit-current)
 	}
-	return vm.Available
+	return available
 }
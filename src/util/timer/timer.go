@@ -2,7 +2,7 @@ package timer
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 )
 
@@ -27,5 +27,5 @@ func (t *Timer) Stop() {
 	}
 	t.started = false
 	duration := time.Since(t.startTime)
-	log.Printf("[timer] %s %s", t.label, duration)
+	slog.Debug("timer", "label", t.label, "duration", duration)
 }